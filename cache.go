@@ -0,0 +1,92 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+// defaultCacheSize is the number of graphs the server caches by default.
+const defaultCacheSize = 128
+
+// CachedWriter renders models like Writer, caching the graphs of the most
+// recently rendered models so that rendering the same model again is free.
+// It is safe for concurrent use.
+type CachedWriter struct {
+	opts []Option
+	size int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List // most recently used first
+}
+
+type cacheEntry struct {
+	key       [sha256.Size]byte
+	result    string
+	cycleInfo *CycleInformation
+}
+
+// NewCachedWriter returns a CachedWriter rendering models with the given
+// options and caching up to size graphs. A size of 0 or less disables the
+// cache.
+func NewCachedWriter(size int, opts ...Option) *CachedWriter {
+	return &CachedWriter{
+		opts:    opts,
+		size:    size,
+		entries: map[[sha256.Size]byte]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Write is like Writer. Models that fail to render aren't cached. The
+// returned CycleInformation is shared between the callers rendering the same
+// model, so it must not be modified.
+func (w *CachedWriter) Write(modelString string) (string, *CycleInformation, error) {
+	if w.size <= 0 {
+		return Writer(modelString, w.opts...)
+	}
+
+	key := sha256.Sum256([]byte(modelString))
+	if entry, ok := w.get(key); ok {
+		return entry.result, entry.cycleInfo, nil
+	}
+
+	result, cycleInfo, err := Writer(modelString, w.opts...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	w.add(&cacheEntry{key: key, result: result, cycleInfo: cycleInfo})
+	return result, cycleInfo, nil
+}
+
+func (w *CachedWriter) get(key [sha256.Size]byte) (*cacheEntry, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	elem, ok := w.entries[key]
+	if !ok {
+		return nil, false
+	}
+	w.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry), true
+}
+
+func (w *CachedWriter) add(entry *cacheEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Another caller may have rendered the same model in the meantime.
+	if elem, ok := w.entries[entry.key]; ok {
+		w.order.MoveToFront(elem)
+		return
+	}
+
+	w.entries[entry.key] = w.order.PushFront(entry)
+	for w.order.Len() > w.size {
+		oldest := w.order.Back()
+		w.order.Remove(oldest)
+		delete(w.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
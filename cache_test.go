@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func cacheTestModel(i int) string {
+	return fmt.Sprintf(`
+		model
+			schema 1.1
+		type user
+		type document%d
+			relations
+				define viewer: [user]`, i)
+}
+
+func TestCachedWriter(t *testing.T) {
+	w := NewCachedWriter(2)
+
+	expected, _, err := Writer(cacheTestModel(0))
+	require.NoError(t, err)
+
+	actual, cycleInfo, err := w.Write(cacheTestModel(0))
+	require.NoError(t, err)
+	require.Equal(t, getSorted(expected), getSorted(actual))
+
+	cached, cachedCycleInfo, err := w.Write(cacheTestModel(0))
+	require.NoError(t, err)
+	require.Equal(t, getSorted(expected), getSorted(cached))
+	require.Same(t, cycleInfo, cachedCycleInfo)
+}
+
+func TestCachedWriter_EvictsLeastRecentlyUsed(t *testing.T) {
+	w := NewCachedWriter(2)
+
+	_, first, err := w.Write(cacheTestModel(0))
+	require.NoError(t, err)
+	_, second, err := w.Write(cacheTestModel(1))
+	require.NoError(t, err)
+
+	// Using the first model makes the second one the least recently used.
+	_, cycleInfo, err := w.Write(cacheTestModel(0))
+	require.NoError(t, err)
+	require.Same(t, first, cycleInfo)
+
+	_, _, err = w.Write(cacheTestModel(2))
+	require.NoError(t, err)
+	require.Equal(t, 2, w.order.Len())
+
+	_, cycleInfo, err = w.Write(cacheTestModel(0))
+	require.NoError(t, err)
+	require.Same(t, first, cycleInfo)
+
+	_, cycleInfo, err = w.Write(cacheTestModel(1))
+	require.NoError(t, err)
+	require.NotSame(t, second, cycleInfo)
+}
+
+func TestCachedWriter_Disabled(t *testing.T) {
+	w := NewCachedWriter(0)
+
+	_, first, err := w.Write(cacheTestModel(0))
+	require.NoError(t, err)
+	_, second, err := w.Write(cacheTestModel(0))
+	require.NoError(t, err)
+	require.NotSame(t, first, second)
+	require.Zero(t, w.order.Len())
+}
+
+func TestCachedWriter_DoesNotCacheErrors(t *testing.T) {
+	w := NewCachedWriter(2)
+
+	_, _, err := w.Write("model\n  schema 1.1\ntype")
+	require.Error(t, err)
+	require.Zero(t, w.order.Len())
+}
+
+func TestCachedWriter_Concurrent(t *testing.T) {
+	w := NewCachedWriter(2)
+
+	expected := make([]string, 4)
+	for i := range expected {
+		var err error
+		expected[i], _, err = Writer(cacheTestModel(i))
+		require.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			actual, _, err := w.Write(cacheTestModel(i % len(expected)))
+			require.NoError(t, err)
+			require.Equal(t, getSorted(expected[i%len(expected)]), getSorted(actual))
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckModel returns an error naming the relations in every definitive cycle
+// of the model, i.e. every cycle made up of computed relations only. OpenFGA
+// rejects such models, so this can be used to lint models before writing them.
+func CheckModel(modelString string) error {
+	cycleInfo, err := Cycles(modelString)
+	if err != nil {
+		return err
+	}
+
+	return definitiveCyclesError(cycleInfo)
+}
+
+// definitiveCyclesError returns an error naming the relations in every
+// definitive cycle found while building a graph, or nil if there are none.
+func definitiveCyclesError(cycleInfo *CycleInformation) error {
+	if len(cycleInfo.definitiveCyclePaths) == 0 {
+		return nil
+	}
+
+	cycles := make([]string, 0, len(cycleInfo.definitiveCyclePaths))
+	for _, cycle := range cycleInfo.definitiveCyclePaths {
+		cycles = append(cycles, strings.Join(cycle, " -> "))
+	}
+
+	return fmt.Errorf("model has %d definitive cycle(s): %s", len(cycles), strings.Join(cycles, "; "))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckModel(t *testing.T) {
+	testCases := map[string]struct {
+		model         string
+		expectedError string
+	}{
+		`definitive_cycle`: {
+			model: `
+				model
+					schema 1.1
+				type resource
+					relations
+						define a: b
+						define b: a`,
+			expectedError: "model has 1 definitive cycle(s): resource#a -> resource#b -> resource#a",
+		},
+		`possible_cycle_only`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define viewer: [user, document#viewer] or editor
+						define editor: [user, document#viewer]`,
+		},
+		`no_cycles`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define viewer: [user]`,
+		},
+		`parse_error`: {
+			model: `
+				model
+					schema 1.1
+				type document
+					relations
+						define viewer [user]`,
+			expectedError: "parse error",
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := CheckModel(test.model)
+			if test.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorContains(t, err, test.expectedError)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// csvHeader names the columns of the CSV output, which has a row per edge.
+var csvHeader = []string{"from", "to", "kind", "condition", "headlabel"}
+
+// WriteCSV writes the edges of the graph to out as CSV, one row per edge in the
+// order they were added (see EdgeList), for reviewing a model in a
+// spreadsheet. The condition of an assignment is given whether it is drawn
+// from a conditioned node, e.g. "user[with condition1]", or in the label of
+// the edge. Values containing commas or quotes are quoted.
+func (g *dotEncodingGraph) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range g.EdgeList() {
+		condition := e.Condition
+		if condition == "" {
+			condition = nodeCondition(e.From)
+		}
+		if err := w.Write([]string{e.From, e.To, e.Kind, condition, e.HeadLabel}); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// nodeCondition returns the condition of a conditioned node label, e.g.
+// condition1 for "user[with condition1]", see nodeLabel, or "" for any other
+// label.
+func nodeCondition(label string) string {
+	_, condition, ok := strings.Cut(label, "[with ")
+	if !ok {
+		return ""
+	}
+	// the condition of a wildcard is followed by :*, e.g. user[with condition1]:*
+	condition, _, _ = strings.Cut(condition, "]")
+	return condition
+}
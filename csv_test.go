@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_CSV(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user with condition1]
+				define viewer: editor or viewer from parent
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	actual, _, err := Writer(model, WithOutputFormat(formatCSV))
+	require.NoError(t, err)
+
+	// there is no header comment, and the union is drawn through an operator
+	// node that is left out of the rows
+	expected := `from,to,kind,condition,headlabel
+user[with condition1],document#editor,direct assignment,condition1,
+folder,document#parent,direct assignment,,
+document#editor,document#viewer,computed userset,,
+folder#viewer,document#viewer,tuple to userset,,(viewer from document#parent)
+user,folder#viewer,direct assignment,,
+`
+	require.Equal(t, expected, actual)
+
+	// the condition is the same when it is drawn in the label of the edge
+	collapsed, _, err := Writer(model, WithOutputFormat(formatCSV), WithCollapsedConditions())
+	require.NoError(t, err)
+	require.Contains(t, collapsed, "\nuser,document#editor,direct assignment,condition1,\n")
+}
+
+func TestWriteCSV_Quoting(t *testing.T) {
+	g := newDotEncodingGraph()
+	g.AddEdge("user", "document#viewer", tupleToUsersetEdge, `(viewer from "a, b")`, "")
+
+	var marshaled strings.Builder
+	require.NoError(t, g.WriteCSV(&marshaled))
+	require.Equal(t, "from,to,kind,condition,headlabel\nuser,document#viewer,tuple to userset,,\"(viewer from \"\"a, b\"\")\"\n", marshaled.String())
+
+	rows, err := csv.NewReader(strings.NewReader(marshaled.String())).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, []string{"user", "document#viewer", "tuple to userset", "", `(viewer from "a, b")`}, rows[1])
+}
+
+func TestNodeCondition(t *testing.T) {
+	require.Equal(t, "condition1", nodeCondition("user[with condition1]"))
+	require.Equal(t, "condition1", nodeCondition("user[with condition1]:*"))
+	require.Empty(t, nodeCondition("user:*"))
+	require.Empty(t, nodeCondition("document#viewer"))
+}
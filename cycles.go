@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/encoding"
+)
+
+// cycleColors are the colors of numbered cycles, in the order of their
+// numbers, wrapping around when there are more cycles. They avoid the colors
+// already meaningful in a highlighted graph: red, gray and blue.
+var cycleColors = []string{"darkorange", "forestgreen", "purple", "deeppink", "goldenrod", "darkcyan", "saddlebrown", "olivedrab"}
+
+// cycleColor is the color of a numbered cycle, as listed by the cycle legend.
+type cycleColor struct {
+	number int
+	color  string
+}
+
+// cycleReport returns a line for every cycle of the model, numbered from 1 in
+// the order they were found, e.g. "cycle 1 (definitive): document#a ->
+// document#b -> document#a". The numbers match the ones of ColorCycles.
+func cycleReport(cycleInfo *CycleInformation) []string {
+	report := make([]string, 0, len(cycleInfo.cycles))
+	for i, cycle := range cycleInfo.cycles {
+		kind := "possible"
+		if cycleInfo.detailedCycles[i].Definitive {
+			kind = "definitive"
+		}
+		report = append(report, fmt.Sprintf("cycle %d (%s): %s", i+1, kind, strings.Join(cycle, " -> ")))
+	}
+	return report
+}
+
+// ColorCycles colors the edges along the given cycles, which are paths of
+// relation labels by cycle number, with a distinct color per cycle. Edges
+// along several cycles get the colors of all of them, drawn as parallel
+// lines. It returns the numbers and colors of the cycles with edges in the
+// graph, sorted by number, for the cycle legend.
+func (g *dotEncodingGraph) ColorCycles(cycles map[int][]string) []cycleColor {
+	numbers := make([]int, 0, len(cycles))
+	for number := range cycles {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	var colors []cycleColor
+	lineColors := map[*dotLine][]string{}
+	for _, number := range numbers {
+		color := cycleColors[(number-1)%len(cycleColors)]
+		inCycle := map[[2]string]bool{}
+		cycle := cycles[number]
+		for i := 0; i < len(cycle)-1; i++ {
+			inCycle[[2]string{cycle[i], cycle[i+1]}] = true
+		}
+
+		colored := false
+		for _, l := range g.SortedLines() {
+			if inCycle[[2]string{g.relationOf(l.From()), g.relationOf(l.To())}] {
+				lineColors[l] = append(lineColors[l], color)
+				colored = true
+			}
+		}
+		if colored {
+			colors = append(colors, cycleColor{number: number, color: color})
+		}
+	}
+
+	for l, lc := range lineColors {
+		l.attrs["color"] = strings.Join(lc, ":")
+		l.attrs["penwidth"] = "2"
+	}
+
+	return colors
+}
+
+// newCycleLegend returns a cluster mapping the colors of numbered cycles to
+// their numbers. Like the legend, it only exists in the marshaled graph.
+func newCycleLegend(colors []cycleColor) *dotCluster {
+	legend := newDotCluster("cluster_cycles", encoding.Attribute{Key: "label", Value: "cycles"})
+
+	for _, c := range colors {
+		description := fmt.Sprintf("cycle %d", c.number)
+		from := &legendNode{Node: legend.NewNode(), id: description + " from", attrs: map[string]string{"label": "", "shape": "point"}}
+		legend.AddNode(from)
+		to := &legendNode{Node: legend.NewNode(), id: description, attrs: map[string]string{"label": description, "shape": "plaintext"}}
+		legend.AddNode(to)
+
+		legend.SetLine(&dotLine{Line: legend.NewLine(from, to), attrs: map[string]string{"color": c.color, "penwidth": "2"}})
+	}
+
+	return legend
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const numberedCyclesModel = `
+	model
+		schema 1.1
+	type user
+	type document
+		relations
+			define a: [user] or b
+			define b: [user] or c
+			define c: [user] or a or b
+			define d: [user] or e
+			define e: [user] or d`
+
+func TestCycleReport(t *testing.T) {
+	cycleInfo, err := Cycles(numberedCyclesModel)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"cycle 1 (definitive): document#a -> document#c -> document#b -> document#a",
+		"cycle 2 (definitive): document#b -> document#c -> document#b",
+		"cycle 3 (definitive): document#d -> document#e -> document#d",
+	}, cycleReport(cycleInfo))
+}
+
+func TestWriter_NumberedCycles(t *testing.T) {
+	actual, _, err := Writer(numberedCyclesModel, WithHighlight("document#a"), WithNumberedCycles())
+	require.NoError(t, err)
+
+	// every highlighted cycle has a color of its own, and the edge from c to
+	// b, along both cycles, has both colors
+	require.Contains(t, actual, `2 -> 8 [
+color=darkorange
+label=9
+penwidth=2
+style=dashed
+];`)
+	require.Contains(t, actual, `5 -> 8 [
+color=forestgreen
+label=10
+penwidth=2
+style=dashed
+];`)
+	require.Contains(t, actual, `7 -> 6 [
+color="darkorange:forestgreen"
+label=6
+penwidth=2
+style=dashed
+];`)
+
+	// cycle 3 isn't derived from document#a, so it's grayed out like the
+	// rest and left out of the legend
+	require.NotContains(t, actual, "goldenrod")
+	require.Contains(t, actual, `subgraph cluster_cycles {
+graph [
+label=cycles
+];
+
+// Node definitions.
+"cycle 1 from" [
+label=""
+shape=point
+];
+"cycle 1" [
+label="cycle 1"
+shape=plaintext
+];
+"cycle 2 from" [
+label=""
+shape=point
+];
+"cycle 2" [
+label="cycle 2"
+shape=plaintext
+];
+
+// Edge definitions.
+"cycle 1 from" -> "cycle 1" [
+color=darkorange
+penwidth=2
+];
+"cycle 2 from" -> "cycle 2" [
+color=forestgreen
+penwidth=2
+];
+}`)
+	require.NotContains(t, actual, `"cycle 3"`)
+
+	// without highlighting, cycles are only numbered in the report
+	actual, _, err = Writer(numberedCyclesModel, WithNumberedCycles())
+	require.NoError(t, err)
+	require.NotContains(t, actual, "darkorange")
+	require.NotContains(t, actual, "cluster_cycles")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// GraphDiff lists the nodes and edges that differ between the graphs of two
+// models. Nodes are identified by their labels, and edges by the labels of the
+// nodes they connect, e.g. "user -> document#editor".
+type GraphDiff struct {
+	addedNodes   []string
+	removedNodes []string
+	addedEdges   []string
+	removedEdges []string
+}
+
+// DiffGraphs returns a graph combining the graphs of both models, in which
+// the nodes and edges only found in the new model are colored green and the
+// ones only found in the old model red, along with the lists of differences.
+func DiffGraphs(oldDSL, newDSL string, opts ...Option) (string, *GraphDiff, error) {
+	oldModel, err := parseModel(oldDSL)
+	if err != nil {
+		return "", nil, fmt.Errorf("old model: %w", err)
+	}
+
+	newModel, err := parseModel(newDSL)
+	if err != nil {
+		return "", nil, fmt.Errorf("new model: %w", err)
+	}
+
+	return DiffModels(oldModel, newModel, opts...)
+}
+
+// DiffModels is like DiffGraphs, for models that are already parsed.
+func DiffModels(oldModel, newModel *openfgav1.AuthorizationModel, opts ...Option) (string, *GraphDiff, error) {
+	o := newOptions(opts...)
+
+	graphAttrs, err := graphAttributes(o)
+	if err != nil {
+		return "", nil, err
+	}
+
+	oldGraph, _ := analyzeModel(oldModel, o)
+	newGraph, _ := analyzeModel(newModel, o)
+
+	g, diff := diffGraphs(oldGraph.RelationGraph(), newGraph.RelationGraph())
+	if o.sortedEdges {
+		g = g.SortedByLabel()
+	}
+	g.NumberEdges()
+	g.fontname = o.fontname
+	g.graphAttrs = graphAttrs
+	g.theme = themes[o.theme]
+	if o.labelIDs {
+		g.UseLabelIDs()
+	}
+
+	multi, err := marshalDOT(g)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to render graph: %w", err)
+	}
+
+	return multi, diff, nil
+}
+
+// diffGraphs combines two graphs into one, coloring what was added and
+// removed, including the nodes without edges kept by WithKeepIsolated.
+func diffGraphs(oldGraph, newGraph *dotEncodingGraph) (*dotEncodingGraph, *GraphDiff) {
+	diff := &GraphDiff{}
+	combined := newDotEncodingGraph()
+
+	oldEdges := map[string]bool{}
+	for _, l := range oldGraph.SortedLines() {
+		oldEdges[oldGraph.describeLine(l)] = true
+	}
+	newEdges := map[string]bool{}
+	for _, l := range newGraph.SortedLines() {
+		newEdges[newGraph.describeLine(l)] = true
+	}
+
+	copyLine := func(from *dotEncodingGraph, l *dotLine, color string) {
+		fromLabel, toLabel := from.reverseMapping[l.From().ID()], from.reverseMapping[l.To().ID()]
+		combined.copyNode(fromLabel, l.From().(*dotNode))
+		combined.copyNode(toLabel, l.To().(*dotNode))
+		copied := combined.AddEdge(fromLabel, toLabel, l.kind, l.attrs["headlabel"], l.condition)
+		if copied == nil {
+			return
+		}
+		copied.copyFrom(l)
+		delete(copied.attrs, "color")
+		if color != "" {
+			copied.attrs["color"] = color
+		}
+	}
+
+	for _, l := range newGraph.SortedLines() {
+		color := ""
+		if description := newGraph.describeLine(l); !oldEdges[description] {
+			diff.addedEdges = append(diff.addedEdges, description)
+			color = "green"
+		}
+		copyLine(newGraph, l, color)
+	}
+	for _, l := range oldGraph.SortedLines() {
+		if description := oldGraph.describeLine(l); !newEdges[description] {
+			diff.removedEdges = append(diff.removedEdges, description)
+			copyLine(oldGraph, l, "red")
+		}
+	}
+	combined.copyNodesWithNoEdges(newGraph, 0)
+	combined.copyNodesWithNoEdges(oldGraph, 0)
+
+	for _, n := range combined.SortedNodes() {
+		label := combined.reverseMapping[n.ID()]
+		_, inOld := oldGraph.mapping[label]
+		_, inNew := newGraph.mapping[label]
+		switch {
+		case !inOld:
+			n.attrs["color"] = "green"
+		case !inNew:
+			n.attrs["color"] = "red"
+		}
+	}
+	for _, label := range newGraph.NodeLabels() {
+		if _, ok := oldGraph.mapping[label]; !ok {
+			diff.addedNodes = append(diff.addedNodes, label)
+		}
+	}
+	for _, label := range oldGraph.NodeLabels() {
+		if _, ok := newGraph.mapping[label]; !ok {
+			diff.removedNodes = append(diff.removedNodes, label)
+		}
+	}
+
+	return combined, diff
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffGraphs(t *testing.T) {
+	oldModel := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define owner: [user]
+				define editor: [user] or owner
+				define viewer: editor`
+
+	newModel := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user]
+				define viewer: [user] or editor`
+
+	actualDOT, diff, err := DiffGraphs(oldModel, newModel)
+	require.NoError(t, err)
+
+	require.Empty(t, diff.addedNodes)
+	require.Equal(t, []string{"document#owner"}, diff.removedNodes)
+	require.Equal(t, []string{"user -> document#viewer"}, diff.addedEdges)
+	require.Equal(t, []string{"document#owner -> document#editor", "user -> document#owner"}, diff.removedEdges)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=user];
+1 [label="document#editor"];
+2 [label="document#viewer"];
+3 [
+color=red
+label="document#owner"
+];
+
+// Edge definitions.
+0 -> 1 [label=1];
+0 -> 2 [
+color=green
+label=2
+];
+0 -> 3 [
+color=red
+label=5
+];
+1 -> 2 [
+label=3
+style=dashed
+];
+3 -> 1 [
+color=red
+label=4
+style=dashed
+];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+}
+
+func TestDiffGraphs_Unchanged(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent`
+
+	actualDOT, diff, err := DiffGraphs(model, model)
+	require.NoError(t, err)
+	require.Equal(t, &GraphDiff{}, diff)
+	require.NotContains(t, actualDOT, "color=")
+}
+
+func TestDiffGraphs_KeepIsolated(t *testing.T) {
+	oldModel := `
+		model
+			schema 1.1
+		type user
+		type orphan
+		type document
+			relations
+				define viewer: [user]`
+
+	newModel := `
+		model
+			schema 1.1
+		type user
+		type archive
+		type document
+			relations
+				define viewer: [user]`
+
+	// types without edges aren't part of the graphs by default
+	_, diff, err := DiffGraphs(oldModel, newModel)
+	require.NoError(t, err)
+	require.Equal(t, &GraphDiff{}, diff)
+
+	actualDOT, diff, err := DiffGraphs(oldModel, newModel, WithKeepIsolated(), WithLabelIDs())
+	require.NoError(t, err)
+	require.Equal(t, []string{"archive"}, diff.addedNodes)
+	require.Equal(t, []string{"orphan"}, diff.removedNodes)
+	require.Contains(t, actualDOT, `archive [
+color=green
+label=archive
+];`)
+	require.Contains(t, actualDOT, `orphan [
+color=red
+label=orphan
+];`)
+}
+
+func TestDiffGraphs_ParseError(t *testing.T) {
+	_, _, err := DiffGraphs("model\n  schema 1.1\ntype user", "type")
+	require.ErrorContains(t, err, "new model: parse error")
+}
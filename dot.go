@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"html"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/encoding"
@@ -10,45 +14,968 @@ import (
 	"gonum.org/v1/gonum/graph/multi"
 )
 
+// edgeKind is the kind of rewrite an edge was drawn for.
+type edgeKind int
+
+const (
+	// directEdge is drawn for a directly related user type.
+	directEdge edgeKind = iota
+	// computedEdge is drawn for a computed userset.
+	computedEdge
+	// tupleToUsersetEdge is drawn for a tuple to userset.
+	tupleToUsersetEdge
+	// operatorEdge connects an operator node to the node it is an operand of.
+	operatorEdge
+)
+
+// String returns the name of the rewrite the edge kind is drawn for, e.g.
+// "computed userset".
+func (k edgeKind) String() string {
+	switch k {
+	case directEdge:
+		return "direct assignment"
+	case computedEdge:
+		return "computed userset"
+	case tupleToUsersetEdge:
+		return "tuple to userset"
+	case operatorEdge:
+		return "operator"
+	default:
+		return fmt.Sprintf("edgeKind(%d)", int(k))
+	}
+}
+
 type dotEncodingGraph struct {
 	*multi.DirectedGraph
 	edgeCounter    int
 	mapping        map[string]int64    // node labels to node IDs
 	reverseMapping map[int64]string    // node IDs to node labels
-	lines          map[string]*dotLine // "fromID-toID-lineID" to line attrs
+	lines          map[string]*dotLine // lineKey of every line to the line
+	// clusterRewrites groups every relation with its operator nodes in a
+	// cluster when the graph is marshaled.
+	clusterRewrites bool
+	// title is the label of the graph, if any.
+	title string
+	// fontname is the font used for all text in the graph, or empty for the
+	// graphviz default.
+	fontname string
+	// graphAttrs are extra graph attributes, overriding the ones above.
+	graphAttrs []encoding.Attribute
+	// legend adds a cluster explaining the styles of the graph.
+	legend bool
+	// theme colors the nodes and edges of the graph, if any; its graph
+	// attributes are part of graphAttrs.
+	theme *theme
+	// typeRanks pin the nodes of some types to a rank, see rankSubgraphs.
+	typeRanks []typeRank
+	// cycleColors adds a cluster mapping the colors of numbered cycles to
+	// their numbers, see ColorCycles.
+	cycleColors []cycleColor
+}
+
+// typeRank pins the nodes of a type to a graphviz rank, e.g. "source".
+type typeRank struct {
+	typeName string
+	rank     string
 }
 
 var _ encoding.Attributer = (*dotEncodingGraph)(nil)
 
 func (g *dotEncodingGraph) DOTAttributers() (graph, node, edge encoding.Attributer) {
-	return g, nil, nil
+	var nodeAttrs, edgeAttrs attributes
+	if g.fontname != "" {
+		font := encoding.Attribute{Key: "fontname", Value: g.fontname}
+		nodeAttrs = append(nodeAttrs, font)
+		edgeAttrs = append(edgeAttrs, font)
+	}
+	if g.theme != nil {
+		nodeAttrs = append(nodeAttrs, g.theme.node...)
+		edgeAttrs = append(edgeAttrs, g.theme.edge...)
+	}
+
+	if len(nodeAttrs) == 0 {
+		return g, nil, nil
+	}
+	return g, nodeAttrs, edgeAttrs
+}
+
+// attributes is a fixed list of attributes shared by all the nodes or edges
+// of a graph.
+type attributes []encoding.Attribute
+
+func (a attributes) Attributes() []encoding.Attribute {
+	return a
 }
 
 func newDotEncodingGraph() *dotEncodingGraph {
-	g := multi.NewDirectedGraph()
-	return &dotEncodingGraph{g, 0, make(map[string]int64), make(map[int64]string), make(map[string]*dotLine)}
+	return &dotEncodingGraph{
+		DirectedGraph:  multi.NewDirectedGraph(),
+		mapping:        make(map[string]int64),
+		reverseMapping: make(map[int64]string),
+		lines:          make(map[string]*dotLine),
+	}
 }
 
 var _ dot.Attributers = (*dotEncodingGraph)(nil)
 
 func (g *dotEncodingGraph) Attributes() []encoding.Attribute {
-	return []encoding.Attribute{{
+	attrs := []encoding.Attribute{{
 		Key:   "rankdir",
 		Value: "BT",
 	}}
+	if g.fontname != "" {
+		attrs = append(attrs, encoding.Attribute{Key: "fontname", Value: g.fontname})
+	}
+	if g.title != "" {
+		attrs = append(attrs,
+			encoding.Attribute{Key: "label", Value: g.title},
+			encoding.Attribute{Key: "labelloc", Value: "t"},
+		)
+	}
+
+	for _, extra := range g.graphAttrs {
+		i := slices.IndexFunc(attrs, func(attr encoding.Attribute) bool {
+			return attr.Key == extra.Key
+		})
+		if i == -1 {
+			attrs = append(attrs, extra)
+		} else {
+			attrs[i] = extra
+		}
+	}
+	return attrs
 }
 
-func (g *dotEncodingGraph) RemoveNodesWithNoEdges() {
-	iter := g.Nodes()
-	for {
-		if !iter.Next() {
+var _ dot.MultiStructurer = (*dotEncodingGraph)(nil)
+
+// Structure returns a cluster for every relation that has operator nodes,
+// containing the relation and its operator nodes, if rewrites are clustered.
+// Within a cluster, the operator nodes at the same nesting depth share a rank.
+// They are followed by the subgraphs pinning types to ranks. The legend, if
+// enabled, and the legend of the colored cycles, if any, are the last clusters.
+func (g *dotEncodingGraph) Structure() []dot.Multigraph {
+	var structure []dot.Multigraph
+	if g.clusterRewrites {
+		structure = g.rewriteClusters()
+	}
+	structure = append(structure, g.rankSubgraphs()...)
+	if g.legend {
+		structure = append(structure, newLegend())
+	}
+	if len(g.cycleColors) > 0 {
+		structure = append(structure, newCycleLegend(g.cycleColors))
+	}
+	return structure
+}
+
+// rewriteClusters returns a cluster for every relation that has operator
+// nodes.
+func (g *dotEncodingGraph) rewriteClusters() []dot.Multigraph {
+	operatorNodes := map[string][]*dotNode{}
+	for _, n := range g.SortedNodes() {
+		if n.operatorOf != "" {
+			operatorNodes[n.operatorOf] = append(operatorNodes[n.operatorOf], n)
+		}
+	}
+
+	relations := make([]string, 0, len(operatorNodes))
+	for relation := range operatorNodes {
+		relations = append(relations, relation)
+	}
+	sort.Strings(relations)
+
+	clusters := make([]dot.Multigraph, 0, len(relations))
+	for i, relation := range relations {
+		cluster := newDotCluster(fmt.Sprintf("cluster_%d", i), encoding.Attribute{Key: "label", Value: relation})
+		if id, ok := g.mapping[relation]; ok && g.Node(id) != nil {
+			cluster.AddNode(g.Node(id))
+		}
+
+		ranks := map[int]*dotCluster{}
+		for _, n := range operatorNodes[relation] {
+			rank, ok := ranks[n.depth]
+			if !ok {
+				rank = newDotCluster("", encoding.Attribute{Key: "rank", Value: "same"})
+				ranks[n.depth] = rank
+			}
+			rank.AddNode(n)
+		}
+
+		depths := make([]int, 0, len(ranks))
+		for depth := range ranks {
+			depths = append(depths, depth)
+		}
+		sort.Ints(depths)
+		for _, depth := range depths {
+			cluster.subgraphs = append(cluster.subgraphs, ranks[depth])
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters
+}
+
+// rankSubgraphs returns a subgraph for every type rank, in the order they
+// were given, setting the rank of the nodes of the type: its plain, wildcard
+// and conditioned nodes and its relations, but not its operator nodes. Types
+// without nodes in the graph get no subgraph.
+func (g *dotEncodingGraph) rankSubgraphs() []dot.Multigraph {
+	var subgraphs []dot.Multigraph
+	for _, r := range g.typeRanks {
+		subgraph := newDotCluster("", encoding.Attribute{Key: "rank", Value: r.rank})
+		for _, n := range g.SortedNodes() {
+			if n.operatorOf == "" && typeOf(g.reverseMapping[n.ID()]) == r.typeName {
+				subgraph.AddNode(n)
+			}
+		}
+		if subgraph.Nodes().Len() > 0 {
+			subgraphs = append(subgraphs, subgraph)
+		}
+	}
+	return subgraphs
+}
+
+// SortedLines returns the lines currently in the graph in the order they were
+// added.
+func (g *dotEncodingGraph) SortedLines() []*dotLine {
+	var lines []*dotLine
+
+	edges := g.Edges()
+	for edges.Next() {
+		e := edges.Edge()
+		iter := g.Lines(e.From().ID(), e.To().ID())
+		for iter.Next() {
+			lines = append(lines, iter.Line().(*dotLine))
+		}
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].seq < lines[j].seq
+	})
+
+	return lines
+}
+
+// EdgeInfo describes an edge of the graph by the labels of the nodes it
+// connects and the attributes it is drawn with.
+type EdgeInfo struct {
+	From      string
+	To        string
+	Label     string
+	Style     string
+	HeadLabel string
+	Weight    int
+	// Kind is the kind of rewrite the edge is drawn for, e.g. "computed
+	// userset", and Condition the condition of a conditioned assignment.
+	Kind      string
+	Condition string
+}
+
+// EdgeList returns the edges currently in the graph in the order they were
+// added, so that they can be inspected without parsing the marshaled graph.
+// It isn't named Edges, which the embedded multi.DirectedGraph already
+// defines for the DOT encoding.
+func (g *dotEncodingGraph) EdgeList() []EdgeInfo {
+	var edges []EdgeInfo
+	for _, l := range g.SortedLines() {
+		edges = append(edges, EdgeInfo{
+			From:      g.reverseMapping[l.From().ID()],
+			To:        g.reverseMapping[l.To().ID()],
+			Label:     l.attrs["label"],
+			Style:     l.attrs["style"],
+			HeadLabel: l.attrs["headlabel"],
+			Weight:    l.weight,
+			Kind:      l.kind.String(),
+			Condition: l.condition,
+		})
+	}
+	return edges
+}
+
+// Subgraph returns a new graph containing copies of the lines for which keep
+// returns true, along with the nodes they connect. The operator edges leading
+// from a kept line to the relation it is an operand of are kept as well.
+func (g *dotEncodingGraph) Subgraph(keep func(l *dotLine) bool) *dotEncodingGraph {
+	kept := map[*dotLine]bool{}
+	var pending []*dotLine
+	for _, l := range g.SortedLines() {
+		if keep(l) {
+			kept[l] = true
+			pending = append(pending, l)
+		}
+	}
+	for len(pending) > 0 {
+		l := pending[0]
+		pending = pending[1:]
+		if l.To().(*dotNode).operatorOf == "" {
+			continue
+		}
+
+		iter := g.From(l.To().ID())
+		for iter.Next() {
+			lines := g.Lines(l.To().ID(), iter.Node().ID())
+			for lines.Next() {
+				next := lines.Line().(*dotLine)
+				if !kept[next] {
+					kept[next] = true
+					pending = append(pending, next)
+				}
+			}
+		}
+	}
+
+	sub := newDotEncodingGraph()
+	sub.clusterRewrites = g.clusterRewrites
+	for _, l := range g.SortedLines() {
+		if !kept[l] {
+			continue
+		}
+
+		from, to := g.reverseMapping[l.From().ID()], g.reverseMapping[l.To().ID()]
+		sub.copyNode(from, l.From().(*dotNode))
+		sub.copyNode(to, l.To().(*dotNode))
+		if copied := sub.AddEdge(from, to, l.kind, l.attrs["headlabel"], l.condition); copied != nil {
+			copied.copyFrom(l)
+		}
+	}
+
+	return sub
+}
+
+// Truncated returns a copy of the graph holding the lines in the order they
+// were added, until adding the next line would take the graph over maxNodes
+// nodes or maxEdges edges, followed by the nodes without edges as long as
+// they fit in maxNodes. A limit of 0 means no limit.
+func (g *dotEncodingGraph) Truncated(maxNodes, maxEdges int) *dotEncodingGraph {
+	truncated := newDotEncodingGraph()
+	truncated.clusterRewrites = g.clusterRewrites
+	for _, l := range g.SortedLines() {
+		if maxEdges > 0 && len(truncated.SortedLines()) >= maxEdges {
+			break
+		}
+
+		from, to := g.reverseMapping[l.From().ID()], g.reverseMapping[l.To().ID()]
+		newNodes := 0
+		if _, ok := truncated.mapping[from]; !ok {
+			newNodes++
+		}
+		if _, ok := truncated.mapping[to]; !ok && to != from {
+			newNodes++
+		}
+		if maxNodes > 0 && truncated.Nodes().Len()+newNodes > maxNodes {
 			break
 		}
-		n := iter.Node()
+
+		truncated.copyNode(from, l.From().(*dotNode))
+		truncated.copyNode(to, l.To().(*dotNode))
+		if copied := truncated.AddEdge(from, to, l.kind, l.attrs["headlabel"], l.condition); copied != nil {
+			copied.copyFrom(l)
+		}
+	}
+	truncated.copyNodesWithNoEdges(g, maxNodes)
+
+	return truncated
+}
+
+// copyNodesWithNoEdges copies the nodes of from that have no edges, such as
+// the ones kept by WithKeepIsolated, until g has maxNodes nodes. A limit of 0
+// means no limit. Copies built from the lines of a graph call it so that they
+// don't lose these nodes.
+func (g *dotEncodingGraph) copyNodesWithNoEdges(from *dotEncodingGraph, maxNodes int) {
+	for _, label := range from.NodesWithNoEdges() {
+		if maxNodes > 0 && g.Nodes().Len() >= maxNodes {
+			return
+		}
+		g.copyNode(label, from.Node(from.mapping[label]).(*dotNode))
+	}
+}
+
+// TypeSummary returns a graph with a node per type, and an edge between two
+// types if any edge of the graph goes from a node of one to a node of the
+// other. Operator nodes are collapsed into the type of their relation. Every
+// edge of the summary records how many edges of the graph it aggregates.
+func (g *dotEncodingGraph) TypeSummary() *dotEncodingGraph {
+	summary := newDotEncodingGraph()
+	lines := map[[2]string]*dotLine{}
+	for _, l := range g.SortedLines() {
+		from, to := typeOf(g.relationOf(l.From())), typeOf(g.relationOf(l.To()))
+		summary.AddOrGetNode(from)
+		summary.AddOrGetNode(to)
+		if from == to {
+			continue
+		}
+
+		key := [2]string{from, to}
+		if _, ok := lines[key]; !ok {
+			lines[key] = summary.AddEdge(from, to, directEdge, "", "")
+		}
+		lines[key].aggregated++
+	}
+	for _, label := range g.NodesWithNoEdges() {
+		summary.AddOrGetNode(typeOf(label))
+	}
+
+	return summary
+}
+
+// LabelCounts adds the number of edges every line of a type summary
+// aggregates to its label, e.g. "1 [3]".
+func (g *dotEncodingGraph) LabelCounts() {
+	for _, l := range g.SortedLines() {
+		if l.aggregated > 0 {
+			l.attrs["label"] = fmt.Sprintf("%s [%d]", l.attrs["label"], l.aggregated)
+		}
+	}
+}
+
+// typeOf returns the type of the node labeled label, e.g. "user" for
+// "user:*", "user[with condition1]" and "document" for "document#viewer".
+func typeOf(label string) string {
+	if i := strings.IndexAny(label, "#:["); i != -1 {
+		return label[:i]
+	}
+	return label
+}
+
+// RelationGraph returns a copy of the graph without operator nodes, in which
+// the edges into an operator node lead to the relation the operator belongs
+// to instead. Such an edge is subtracted if the operator node, or an operator
+// it is nested in, is the subtracted operand of an exclusion, e.g. the edges
+// of b and d in "a but not (b or d)". It is the graph the model is analyzed
+// on, so that cycles and metrics do not depend on how the rewrites are drawn.
+func (g *dotEncodingGraph) RelationGraph() *dotEncodingGraph {
+	rg := newDotEncodingGraph()
+	nodes := graph.NodesOf(g.Nodes())
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID() < nodes[j].ID()
+	})
+	for _, n := range nodes {
+		if n.(*dotNode).operatorOf == "" {
+			rg.copyNode(g.reverseMapping[n.ID()], n.(*dotNode))
+		}
+	}
+
+	for _, l := range g.SortedLines() {
+		if l.kind == operatorEdge {
+			continue
+		}
+
+		from, to := g.reverseMapping[l.From().ID()], g.relationOf(l.To())
+		subtracted := l.subtracted || g.inSubtractedOperator(l.To())
+		if copied := rg.addLine(from, "", to, "", l.kind, l.attrs["headlabel"], l.condition, subtracted); copied != nil {
+			copied.copyFrom(l)
+			if subtracted {
+				copied.subtract()
+			}
+		}
+	}
+
+	return rg
+}
+
+// inSubtractedOperator reports whether the node n is an operator node that is,
+// or is nested in, the subtracted operand of an exclusion, following the
+// edges from operator nodes up to the relation they belong to.
+func (g *dotEncodingGraph) inSubtractedOperator(n graph.Node) bool {
+	for n.(*dotNode).operatorOf != "" {
+		to := g.From(n.ID())
+		if !to.Next() {
+			return false
+		}
+		if !grants(g, n.ID(), to.Node().ID()) {
+			return true
+		}
+		n = to.Node()
+	}
+	return false
+}
+
+// Reversed returns a copy of the graph in which every edge points the other
+// way, from the relation to what it grants. Head labels, which are placed next
+// to the relation, become tail labels so that they stay next to it.
+func (g *dotEncodingGraph) Reversed() *dotEncodingGraph {
+	rev := newDotEncodingGraph()
+	rev.clusterRewrites = g.clusterRewrites
+	rev.title = g.title
+
+	nodes := graph.NodesOf(g.Nodes())
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID() < nodes[j].ID()
+	})
+	for _, n := range nodes {
+		rev.copyNode(g.reverseMapping[n.ID()], n.(*dotNode))
+	}
+
+	for _, l := range g.SortedLines() {
+		from := rev.Node(rev.mapping[g.reverseMapping[l.To().ID()]])
+		to := rev.Node(rev.mapping[g.reverseMapping[l.From().ID()]])
+
+		reversed := rev.NewLine(from, to)
+		rev.DirectedGraph.SetLine(reversed)
+		rev.edgeCounter++
+		reversed.seq = l.seq
+		reversed.kind = l.kind
+		reversed.condition = l.condition
+		reversed.copyFrom(l)
+		reversed.fromPort, reversed.toPort = l.toPort, l.fromPort
+		if headlabel, ok := reversed.attrs["headlabel"]; ok {
+			delete(reversed.attrs, "headlabel")
+			reversed.attrs["taillabel"] = headlabel
+		}
+	}
+
+	return rev
+}
+
+// SortedByLabel returns a copy of the graph whose nodes are added in the order
+// of their labels. The DOT encoder writes nodes and edges in the order of
+// their IDs, so the node definitions of the copy are sorted by label, and its
+// edge definitions by the label of their source, then the label of their
+// target, then the order in which they were added.
+func (g *dotEncodingGraph) SortedByLabel() *dotEncodingGraph {
+	sorted := newDotEncodingGraph()
+	sorted.clusterRewrites = g.clusterRewrites
+	sorted.title = g.title
+
+	for _, n := range g.SortedNodes() {
+		sorted.copyNode(g.reverseMapping[n.ID()], n)
+	}
+
+	for _, l := range g.SortedLines() {
+		from := sorted.Node(sorted.mapping[g.reverseMapping[l.From().ID()]])
+		to := sorted.Node(sorted.mapping[g.reverseMapping[l.To().ID()]])
+
+		copied := sorted.NewLine(from, to)
+		sorted.DirectedGraph.SetLine(copied)
+		sorted.edgeCounter++
+		copied.seq = l.seq
+		copied.kind = l.kind
+		copied.condition = l.condition
+		copied.copyFrom(l)
+	}
+
+	return sorted
+}
+
+// TuplesetHops returns a copy of the graph in which every tuple to userset
+// edge is drawn as two hops through the node of its tupleset relation, e.g.
+// folder#viewer -> document#parent -> document#viewer for "viewer from
+// parent", the way tuple to usersets are evaluated. The head label stays on
+// the second hop.
+func (g *dotEncodingGraph) TuplesetHops() *dotEncodingGraph {
+	hops := newDotEncodingGraph()
+	hops.clusterRewrites = g.clusterRewrites
+	hops.title = g.title
+
+	for _, l := range g.SortedLines() {
+		from, to := g.reverseMapping[l.From().ID()], g.reverseMapping[l.To().ID()]
+		hops.copyNode(from, l.From().(*dotNode))
+		hops.copyNode(to, l.To().(*dotNode))
+
+		if l.tupleset == "" {
+			if copied := hops.AddEdge(from, to, l.kind, l.attrs["headlabel"], l.condition); copied != nil {
+				copied.copyFrom(l)
+			}
+			continue
+		}
+
+		if id, ok := g.mapping[l.tupleset]; ok && g.Node(id) != nil {
+			hops.copyNode(l.tupleset, g.Node(id).(*dotNode))
+		}
+		if first := hops.AddEdge(from, l.tupleset, l.kind, "", l.condition); first != nil {
+			first.copyFrom(l)
+			delete(first.attrs, "headlabel")
+		}
+		if second := hops.AddEdge(l.tupleset, to, l.kind, l.attrs["headlabel"], ""); second != nil {
+			second.copyFrom(l)
+		}
+	}
+	hops.copyNodesWithNoEdges(g, 0)
+
+	return hops
+}
+
+// describeLine identifies a line by the labels of the nodes it connects, its
+// head label and its condition, e.g. "user -> document#editor".
+func (g *dotEncodingGraph) describeLine(l *dotLine) string {
+	description := fmt.Sprintf("%s -> %s", g.reverseMapping[l.From().ID()], g.reverseMapping[l.To().ID()])
+	if headlabel := l.attrs["headlabel"]; headlabel != "" {
+		description = fmt.Sprintf("%s %s", description, headlabel)
+	}
+	if l.condition != "" {
+		description = fmt.Sprintf("%s [with %s]", description, l.condition)
+	}
+	return description
+}
+
+// SortedNodes returns the nodes currently in the graph sorted by label. Unlike
+// iterating over Nodes, whose order gonum leaves unspecified, it visits the
+// nodes in the same order on every run.
+func (g *dotEncodingGraph) SortedNodes() []*dotNode {
+	nodes := make([]*dotNode, 0, g.Nodes().Len())
+	iter := g.Nodes()
+	for iter.Next() {
+		nodes = append(nodes, iter.Node().(*dotNode))
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return g.reverseMapping[nodes[i].ID()] < g.reverseMapping[nodes[j].ID()]
+	})
+	return nodes
+}
+
+// NodeLabels returns the labels of the nodes currently in the graph, sorted,
+// so that they can be inspected without parsing the marshaled graph. Like
+// EdgeList, it reflects the graph as it is, e.g. without the nodes removed by
+// RemoveNodesWithNoEdges.
+func (g *dotEncodingGraph) NodeLabels() []string {
+	nodes := g.SortedNodes()
+	labels := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		labels = append(labels, g.reverseMapping[n.ID()])
+	}
+	return labels
+}
+
+// relationOf returns the label of the relation an operator node belongs to,
+// or the label of n itself for every other node.
+func (g *dotEncodingGraph) relationOf(n graph.Node) string {
+	if relation := n.(*dotNode).operatorOf; relation != "" {
+		return relation
+	}
+	return g.reverseMapping[n.ID()]
+}
+
+// copyNode adds a copy of the node n of another graph under the given label,
+// unless a node with that label already exists.
+func (g *dotEncodingGraph) copyNode(label string, n *dotNode) {
+	if _, ok := g.mapping[label]; ok {
+		return
+	}
+
+	copied := g.AddOrGetNode(label).(*dotNode)
+	for k, v := range n.attrs {
+		copied.attrs[k] = v
+	}
+	copied.operatorOf = n.operatorOf
+	copied.depth = n.depth
+}
+
+// UseHTMLLabels renders the labels of the relation nodes currently in the
+// graph as HTML-like labels, with their type prefix in bold.
+func (g *dotEncodingGraph) UseHTMLLabels() {
+	iter := g.Nodes()
+	for iter.Next() {
+		iter.Node().(*dotNode).htmlLabel = true
+	}
+}
+
+// Highlight emphasizes the node labeled label, and every node and edge from
+// which it can be reached, i.e. everything it is derived from, and grays out
+// the rest of the graph. It returns the labels of the highlighted nodes,
+// sorted.
+func (g *dotEncodingGraph) Highlight(label string) []string {
+	highlighted := g.derivedFrom(g.mapping[label])
+
+	var labels []string
+	for _, n := range g.SortedNodes() {
+		if !highlighted[n.ID()] {
+			n.attrs["color"] = "gray"
+			n.attrs["fontcolor"] = "gray"
+			continue
+		}
+
+		labels = append(labels, g.reverseMapping[n.ID()])
+		n.attrs["penwidth"] = "2"
+	}
+	target := g.Node(g.mapping[label]).(*dotNode)
+	target.attrs["color"] = "red"
+
+	for _, l := range g.SortedLines() {
+		if highlighted[l.To().ID()] {
+			l.attrs["penwidth"] = "2"
+		} else {
+			l.attrs["color"] = "gray"
+			l.attrs["fontcolor"] = "gray"
+		}
+	}
+
+	return labels
+}
+
+// derivedFrom returns the IDs of the node id and of every node from which it
+// can be reached.
+func (g *dotEncodingGraph) derivedFrom(id int64) map[int64]bool {
+	return g.reachedFrom(id, false)
+}
+
+// grantedFrom is like derivedFrom, but doesn't follow the subtracted operands
+// of exclusions, which deny rather than grant, see grants.
+func (g *dotEncodingGraph) grantedFrom(id int64) map[int64]bool {
+	return g.reachedFrom(id, true)
+}
+
+// reachedFrom returns the IDs of the node id and of every node from which it
+// can be reached, only through edges that grant if grantingOnly is true.
+func (g *dotEncodingGraph) reachedFrom(id int64, grantingOnly bool) map[int64]bool {
+	reached := map[int64]bool{id: true}
+	queue := []int64{id}
+	for len(queue) > 0 {
+		to := queue[0]
+		from := g.To(to)
+		queue = queue[1:]
+		for from.Next() {
+			id := from.Node().ID()
+			if reached[id] || grantingOnly && !grants(g, id, to) {
+				continue
+			}
+			reached[id] = true
+			queue = append(queue, id)
+		}
+	}
+	return reached
+}
+
+// GrantedUserTypes returns the concrete user types that can ultimately be
+// granted the relation node labeled label, sorted, i.e. the types of the
+// user, wildcard and conditioned nodes it can be reached from through direct,
+// computed and tuple to userset edges. The subtracted operands of exclusions
+// are not followed, as their users are denied the relation.
+func (g *dotEncodingGraph) GrantedUserTypes(label string) []string {
+	var types []string
+	for id := range g.grantedFrom(g.mapping[label]) {
+		n := g.Node(id).(*dotNode)
+		from := g.reverseMapping[id]
+		if n.operatorOf != "" || strings.Contains(from, "#") {
+			continue
+		}
+		if t := typeOf(from); !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// LabelClosureSizes adds the number of concrete user types that can
+// ultimately be granted every relation currently in the graph to its label,
+// e.g. "document#viewer\n(2 user types)", as a sense of how broad the
+// relation is.
+func (g *dotEncodingGraph) LabelClosureSizes() {
+	for _, n := range g.SortedNodes() {
+		label := g.reverseMapping[n.ID()]
+		if n.operatorOf != "" || !strings.Contains(label, "#") {
+			continue
+		}
+
+		size := len(g.GrantedUserTypes(label))
+		unit := "user types"
+		if size == 1 {
+			unit = "user type"
+		}
+
+		text := n.attrs["label"]
+		if unquoted, err := strconv.Unquote(text); err == nil {
+			text = unquoted
+		}
+		n.attrs["label"] = strconv.Quote(fmt.Sprintf("%s\n(%d %s)", text, size, unit))
+	}
+}
+
+// LabelWildcards displays the labels of the wildcard nodes currently in the
+// graph, e.g. "user:*", as the given template, in which {type} is replaced by
+// the type, e.g. "{type} (public)" for "user (public)". The nodes are still
+// identified by their wildcard labels.
+func (g *dotEncodingGraph) LabelWildcards(template string) {
+	for _, n := range g.SortedNodes() {
+		if typeName, ok := strings.CutSuffix(g.reverseMapping[n.ID()], ":*"); ok {
+			n.attrs["label"] = strings.ReplaceAll(template, "{type}", typeName)
+		}
+	}
+}
+
+// LabelTuplesets displays the head labels of the tuple to userset edges
+// currently in the graph, e.g. "(viewer from document#parent)", as the given
+// template, in which {relation} is replaced by the relation, {type} by the
+// type of the tupleset and {tupleset} by the tupleset relation, e.g. "from
+// {tupleset}" for "from parent". Head labels that became tail labels when the
+// graph was reversed are displayed the same way.
+func (g *dotEncodingGraph) LabelTuplesets(template string) {
+	for _, l := range g.SortedLines() {
+		if l.kind != tupleToUsersetEdge {
+			continue
+		}
+		for _, key := range []string{"headlabel", "taillabel"} {
+			relation, typeName, tupleset, ok := parseTuplesetLabel(l.attrs[key])
+			if !ok {
+				continue
+			}
+			l.attrs[key] = strings.NewReplacer("{relation}", relation, "{type}", typeName, "{tupleset}", tupleset).Replace(template)
+		}
+	}
+}
+
+// parseTuplesetLabel returns the relation, tupleset type and tupleset relation
+// of the head label of a tuple to userset edge, e.g. viewer, document and
+// parent for "(viewer from document#parent)".
+func parseTuplesetLabel(label string) (relation, typeName, tupleset string, ok bool) {
+	inner, ok := strings.CutPrefix(label, "(")
+	if !ok {
+		return "", "", "", false
+	}
+	if inner, ok = strings.CutSuffix(inner, ")"); !ok {
+		return "", "", "", false
+	}
+	relation, from, ok := strings.Cut(inner, " from ")
+	if !ok {
+		return "", "", "", false
+	}
+	typeName, tupleset, ok = strings.Cut(from, "#")
+	return relation, typeName, tupleset, ok
+}
+
+// LabelConditionSignatures adds the signature of their condition to the
+// labels of the conditioned nodes currently in the graph, given by condition
+// name, e.g. "user[with condition1(x: int)]" for "user[with condition1]".
+func (g *dotEncodingGraph) LabelConditionSignatures(signatures map[string]string) {
+	for _, n := range g.SortedNodes() {
+		label := n.attrs["label"]
+		condition := nodeCondition(g.reverseMapping[n.ID()])
+		if signature, ok := signatures[condition]; ok {
+			n.attrs["label"] = strings.Replace(label, "[with "+condition+"]", "[with "+condition+signature+"]", 1)
+		}
+	}
+}
+
+// ShapeNodes draws the type nodes currently in the graph, including wildcard
+// and conditioned ones such as "user:*", as boxes and the relation nodes as
+// ellipses, so that they can be told apart without color, e.g. when printed.
+// Nodes that already have a shape, such as operator and record nodes, keep
+// it.
+func (g *dotEncodingGraph) ShapeNodes() {
+	for _, n := range g.SortedNodes() {
+		if n.attrs["shape"] != "" {
+			continue
+		}
+		if strings.Contains(g.reverseMapping[n.ID()], "#") {
+			n.attrs["shape"] = "ellipse"
+		} else {
+			n.attrs["shape"] = "box"
+		}
+	}
+}
+
+// UseLabelIDs replaces the numeric IDs of the nodes currently in the graph in
+// the DOT output with IDs derived from their labels, e.g. document_viewer for
+// document#viewer and user_wildcard for user:*, so that the IDs don't shift
+// when the model changes. The nodes keep their labels. IDs that would collide,
+// including with the nodes of the legend, get a numeric suffix in the order
+// of the labels, e.g. user_2.
+func (g *dotEncodingGraph) UseLabelIDs() {
+	taken := map[string]bool{"operator": true}
+	for _, entry := range legendEntries {
+		taken[entry.description] = true
+		taken[entry.description+" from"] = true
+	}
+
+	for _, n := range g.SortedNodes() {
+		base := labelID(g.reverseMapping[n.ID()])
+		id := base
+		for i := 2; taken[id]; i++ {
+			id = fmt.Sprintf("%s_%d", base, i)
+		}
+		taken[id] = true
+		n.dotID = id
+	}
+}
+
+// labelID returns label with every run of characters other than letters,
+// digits and underscores replaced by an underscore, and the wildcard * spelled
+// out, e.g. document_viewer for document#viewer.
+func labelID(label string) string {
+	label = strings.ReplaceAll(label, "*", "wildcard")
+
+	var sb strings.Builder
+	separated := false
+	for _, r := range label {
+		if r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			sb.WriteRune(r)
+			separated = false
+			continue
+		}
+		if !separated && sb.Len() > 0 {
+			sb.WriteByte('_')
+			separated = true
+		}
+	}
+
+	id := strings.TrimSuffix(sb.String(), "_")
+	if id == "" {
+		return "node"
+	}
+	return id
+}
+
+// NumberEdges labels the edges currently in the graph 1..N in the order they
+// were added, followed by the condition of the edge if it has one. The
+// numbering is independent of the IDs gonum assigns to nodes and lines, so it
+// has no gaps even after nodes or edges were removed.
+func (g *dotEncodingGraph) NumberEdges() {
+	for i, l := range g.SortedLines() {
+		l.attrs["label"] = strconv.Itoa(i + 1)
+		if l.condition != "" {
+			l.attrs["label"] = fmt.Sprintf("%d [with %s]", i+1, l.condition)
+		}
+	}
+}
+
+// markSubtracted marks the edges drawn into target since the edge counter was
+// at added as the subtracted operand of an exclusion, so that it can be told
+// apart from the base: "a but not b" is not symmetric.
+func (g *dotEncodingGraph) markSubtracted(target string, added int) {
+	targetID := g.mapping[target]
+	for _, l := range g.SortedLines() {
+		if l.seq > added && l.To().ID() == targetID {
+			l.subtract()
+		}
+	}
+}
+
+// RemoveNodesWithNoEdges removes every node that has no incoming or outgoing
+// edges and returns the labels of the removed nodes, sorted. The plain node of
+// a type and its wildcard node are separate nodes, so a type that is only
+// referenced as a wildcard, e.g. folder:*, loses its unused plain node.
+func (g *dotEncodingGraph) RemoveNodesWithNoEdges() []string {
+	removed := g.NodesWithNoEdges()
+	g.RemoveNodes(removed)
+	return removed
+}
+
+// NodesWithNoEdges returns the labels of the nodes that have no incoming or
+// outgoing edges, sorted.
+func (g *dotEncodingGraph) NodesWithNoEdges() []string {
+	var labels []string
+	for _, n := range g.SortedNodes() {
 		if !g.DirectedGraph.From(n.ID()).Next() && !g.DirectedGraph.To(n.ID()).Next() {
-			g.RemoveNode(n.ID())
+			labels = append(labels, g.reverseMapping[n.ID()])
 		}
 	}
+	return labels
+}
+
+// RemoveNodes removes the nodes with the given labels, which must have no
+// edges, e.g. some of the nodes returned by NodesWithNoEdges. Labels of nodes
+// that aren't in the graph are ignored.
+func (g *dotEncodingGraph) RemoveNodes(labels []string) {
+	for _, label := range labels {
+		id, ok := g.mapping[label]
+		if !ok {
+			continue
+		}
+		g.RemoveNode(id)
+		delete(g.mapping, label)
+		delete(g.reverseMapping, id)
+	}
 }
 
 func (g *dotEncodingGraph) NewNode() *dotNode {
@@ -58,10 +985,18 @@ func (g *dotEncodingGraph) NewNode() *dotNode {
 func (g *dotEncodingGraph) NewLine(from, to graph.Node) *dotLine {
 	line := g.DirectedGraph.NewLine(from, to)
 	dotLine := &dotLine{Line: line, attrs: make(map[string]string)}
-	g.lines[fmt.Sprintf("%v-%v-%v", from.ID(), to.ID(), line.ID())] = dotLine
+	g.lines[lineKey(from.ID(), to.ID(), line.ID())] = dotLine
 	return dotLine
 }
 
+// lineKey returns the key of the line with the given ID between the nodes
+// from and to in the lines of a graph, e.g. "2-4-7". Lines are both stored and
+// looked up by it, so that a lookup can't miss a line stored under another
+// key format.
+func lineKey(from, to, id int64) string {
+	return fmt.Sprintf("%v-%v-%v", from, to, id)
+}
+
 func (g *dotEncodingGraph) AddOrGetNode(label string) graph.Node {
 	if id, ok := g.mapping[label]; ok {
 		return g.Node(id)
@@ -75,7 +1010,40 @@ func (g *dotEncodingGraph) AddOrGetNode(label string) graph.Node {
 	return n
 }
 
-func (g *dotEncodingGraph) AddEdge(from, to string, optionalHeadLabel, optionalStyle string) graph.Line {
+// AddOperatorNode adds a node for a boolean operator in the rewrite of the
+// given relation. Operator nodes are identified by key, but displayed with
+// the operator as their label. depth is the nesting depth of the operator in
+// the rewrite, starting at 1.
+func (g *dotEncodingGraph) AddOperatorNode(key, operator, relation string, depth int) graph.Node {
+	n := g.AddOrGetNode(key).(*dotNode)
+	n.attrs["label"] = operator
+	n.attrs["shape"] = "diamond"
+	n.operatorOf = relation
+	n.depth = depth
+	return n
+}
+
+// AddEdge adds an edge of the given kind between the nodes labeled from and
+// to, creating them if needed. The optional condition is the name of the
+// condition the edge is conditioned on, when conditions are not part of the
+// node labels. An edge is only added once per distinct headlabel and
+// condition; nil is returned for duplicates.
+func (g *dotEncodingGraph) AddEdge(from, to string, kind edgeKind, optionalHeadLabel, optionalCondition string) *dotLine {
+	return g.AddPortEdge(from, "", to, "", kind, optionalHeadLabel, optionalCondition)
+}
+
+// AddPortEdge is like AddEdge, but wires the edge to the given ports of the
+// nodes labeled from and to, such as the fields of record nodes. An empty port
+// wires the edge to the whole node. Edges wired to different ports are
+// distinct, even if they connect the same nodes.
+func (g *dotEncodingGraph) AddPortEdge(from, fromPort, to, toPort string, kind edgeKind, optionalHeadLabel, optionalCondition string) *dotLine {
+	return g.addLine(from, fromPort, to, toPort, kind, optionalHeadLabel, optionalCondition, false)
+}
+
+// addLine is like AddPortEdge, for a line that is the subtracted operand of an
+// exclusion or not. A subtracted line and a line that grants are distinct,
+// even if they connect the same nodes, so that neither stands for the other.
+func (g *dotEncodingGraph) addLine(from, fromPort, to, toPort string, kind edgeKind, optionalHeadLabel, optionalCondition string, subtracted bool) *dotLine {
 	n1 := g.AddOrGetNode(from)
 	n2 := g.AddOrGetNode(to)
 	existingLinesIter := g.Lines(n1.ID(), n2.ID())
@@ -83,8 +1051,8 @@ func (g *dotEncodingGraph) AddEdge(from, to string, optionalHeadLabel, optionalS
 		if !existingLinesIter.Next() {
 			break
 		}
-		e := existingLinesIter.Line()
-		if g.lines[fmt.Sprintf("%v-%v-%v", n1.ID(), n2.ID(), e.ID())].attrs["headlabel"] == optionalHeadLabel {
+		e := g.lines[lineKey(n1.ID(), n2.ID(), existingLinesIter.Line().ID())]
+		if e.attrs["headlabel"] == optionalHeadLabel && e.condition == optionalCondition && e.fromPort == fromPort && e.toPort == toPort && e.subtracted == subtracted {
 			// duplicate!
 			return nil
 		}
@@ -93,17 +1061,24 @@ func (g *dotEncodingGraph) AddEdge(from, to string, optionalHeadLabel, optionalS
 	//fmt.Println("adding edge", from, "-->", to, "[", g.edgeCounter, "]", "headlabel", optionalHeadLabel)
 	edge := g.NewLine(n1, n2)
 	g.DirectedGraph.SetLine(edge)
-	edge.attrs["label"] = strconv.Itoa(g.edgeCounter)
+	edge.seq = g.edgeCounter
+	edge.kind = kind
+	edge.condition = optionalCondition
+	edge.fromPort, edge.toPort = fromPort, toPort
 	if optionalHeadLabel != "" {
 		edge.attrs["headlabel"] = optionalHeadLabel
 	}
-	if optionalStyle != "" {
-		edge.attrs["style"] = optionalStyle
+	if kind == computedEdge {
+		edge.attrs["style"] = "dashed"
+	}
+	if g.relationOf(n2) == from && fromPort == toPort {
+		// the relation refers to itself, e.g. recursive group membership
+		edge.attrs["color"] = "blue"
 	}
-	return &dotLine{
-		Line:  edge,
-		attrs: edge.attrs,
+	if subtracted {
+		edge.subtract()
 	}
+	return edge
 }
 
 var _ encoding.Attributer = (*dotNode)(nil)
@@ -111,12 +1086,41 @@ var _ encoding.Attributer = (*dotNode)(nil)
 type dotNode struct {
 	graph.Node
 	attrs map[string]string
+	// operatorOf is the label of the relation whose rewrite an operator node
+	// belongs to; it is empty for every other node.
+	operatorOf string
+	// depth is the nesting depth of an operator node in its rewrite.
+	depth int
+	// htmlLabel renders the label as an HTML-like label with its type prefix
+	// in bold.
+	htmlLabel bool
+	// dotID replaces the ID of the node in the DOT output, see UseLabelIDs.
+	dotID string
+}
+
+var _ dot.Node = (*dotNode)(nil)
+
+// DOTID returns the ID of the node in the DOT output, which is its gonum ID
+// unless UseLabelIDs gave it one derived from its label.
+func (d *dotNode) DOTID() string {
+	if d.dotID != "" {
+		return d.dotID
+	}
+	return strconv.FormatInt(d.ID(), 10)
 }
 
 func (d *dotNode) Attributes() []encoding.Attribute {
 	var attrs []encoding.Attribute
 
-	for k, val := range d.attrs {
+	for _, k := range sortedKeys(d.attrs) {
+		val := d.attrs[k]
+		if val == "" {
+			// an empty value means the same as no value, so it is only noise
+			continue
+		}
+		if k == "label" && d.htmlLabel {
+			val = htmlLabel(val)
+		}
 		attrs = append(attrs, encoding.Attribute{
 			Key:   k,
 			Value: val,
@@ -125,21 +1129,135 @@ func (d *dotNode) Attributes() []encoding.Attribute {
 	return attrs
 }
 
+// sortedKeys returns the keys of attrs sorted, so that attributes are written
+// in the same order on every run.
+func sortedKeys(attrs map[string]string) []string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// htmlLabel returns the HTML-like label for a relation label such as
+// "document#viewer", in which the type prefix "document#" is in bold. Labels
+// of other nodes are returned as is.
+func htmlLabel(label string) string {
+	unquoted := label
+	if s, err := strconv.Unquote(label); err == nil {
+		unquoted = s
+	}
+
+	typeName, relation, ok := strings.Cut(unquoted, "#")
+	if !ok {
+		return label
+	}
+
+	escape := func(s string) string {
+		return strings.ReplaceAll(html.EscapeString(s), "\n", "<br/>")
+	}
+	return fmt.Sprintf("<<b>%s#</b>%s>", escape(typeName), escape(relation))
+}
+
 var _ encoding.Attributer = (*dotLine)(nil)
 
 type dotLine struct {
 	graph.Line
-	attrs map[string]string
+	seq        int      // order in which the line was added to the graph
+	kind       edgeKind // kind of rewrite the line was drawn for
+	condition  string   // condition the edge is conditioned on, if not part of the source node
+	userType   string   // type of the concrete users a direct edge is drawn from, if any
+	weight     int      // cost of evaluating the edge, see AssignWeights
+	tupleset   string   // label of the tupleset relation a tuple to userset edge is drawn through, if any
+	aggregated int      // number of edges a type summary edge stands for, see TypeSummary
+	fromPort   string   // port of the source node the line is wired to, if any, see AddPortEdge
+	toPort     string   // port of the target node the line is wired to, if any
+	operators  []string // intersections and exclusions the rewrite of the line is an operand of, if any, see graphBuilder.addEdge
+	subtracted bool     // the line is the subtracted operand of an exclusion, see markSubtracted
+	attrs      map[string]string
+}
+
+// copyFrom copies the attributes of the line src of another graph, and what
+// it was drawn from, to l.
+func (l *dotLine) copyFrom(src *dotLine) {
+	for k, v := range src.attrs {
+		l.attrs[k] = v
+	}
+	l.userType = src.userType
+	l.weight = src.weight
+	l.tupleset = src.tupleset
+	l.aggregated = src.aggregated
+	l.fromPort, l.toPort = src.fromPort, src.toPort
+	l.operators = slices.Clone(src.operators)
+	l.subtracted = src.subtracted
+}
+
+// subtract marks the line as the subtracted operand of an exclusion, drawn
+// with a tee arrowhead.
+func (l *dotLine) subtract() {
+	l.subtracted = true
+	l.attrs["arrowhead"] = "tee"
+}
+
+var _ dot.Porter = (*dotLine)(nil)
+
+// FromPort returns the port of the source node the line is wired to.
+func (d *dotLine) FromPort() (port, compass string) {
+	return d.fromPort, ""
+}
+
+// ToPort returns the port of the target node the line is wired to.
+func (d *dotLine) ToPort() (port, compass string) {
+	return d.toPort, ""
 }
 
 func (d *dotLine) Attributes() []encoding.Attribute {
 	var attrs []encoding.Attribute
 
-	for k, val := range d.attrs {
+	for _, k := range sortedKeys(d.attrs) {
+		if d.attrs[k] == "" {
+			continue
+		}
 		attrs = append(attrs, encoding.Attribute{
 			Key:   k,
-			Value: val,
+			Value: d.attrs[k],
 		})
 	}
 	return attrs
 }
+
+var (
+	_ dot.Multigraph      = (*dotCluster)(nil)
+	_ dot.Attributers     = (*dotCluster)(nil)
+	_ dot.MultiStructurer = (*dotCluster)(nil)
+)
+
+// dotCluster is a subgraph of a dotEncodingGraph. It only holds nodes, the
+// edges between them are marshaled as part of the enclosing graph.
+type dotCluster struct {
+	*multi.DirectedGraph
+	id        string
+	attrs     []encoding.Attribute
+	subgraphs []dot.Multigraph
+}
+
+func newDotCluster(id string, attrs ...encoding.Attribute) *dotCluster {
+	return &dotCluster{DirectedGraph: multi.NewDirectedGraph(), id: id, attrs: attrs}
+}
+
+func (c *dotCluster) DOTID() string {
+	return c.id
+}
+
+func (c *dotCluster) DOTAttributers() (graph, node, edge encoding.Attributer) {
+	return c, nil, nil
+}
+
+func (c *dotCluster) Attributes() []encoding.Attribute {
+	return c.attrs
+}
+
+func (c *dotCluster) Structure() []dot.Multigraph {
+	return c.subgraphs
+}
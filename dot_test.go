@@ -0,0 +1,256 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph/encoding"
+)
+
+func TestRemoveNodesWithNoEdges(t *testing.T) {
+	g := newDotEncodingGraph()
+	for _, label := range []string{"user", "group", "document#owner", "document#viewer", "folder", "folder#viewer"} {
+		g.AddOrGetNode(label)
+	}
+	g.AddEdge("user", "document#owner", directEdge, "", "")
+	g.AddEdge("document#owner", "document#viewer", computedEdge, "", "")
+
+	removed := g.RemoveNodesWithNoEdges()
+	require.Equal(t, []string{"folder", "folder#viewer", "group"}, removed)
+	require.Equal(t, []string{"document#owner", "document#viewer", "user"}, g.NodeLabels())
+}
+
+func TestRemoveNodesWithNoEdges_ReAddedLabel(t *testing.T) {
+	g := newDotEncodingGraph()
+	g.AddOrGetNode("document#viewer")
+	g.AddEdge("user", "document#owner", directEdge, "", "")
+
+	require.Equal(t, []string{"document#viewer"}, g.RemoveNodesWithNoEdges())
+	require.NotContains(t, g.mapping, "document#viewer")
+
+	n := g.AddOrGetNode("document#viewer")
+	require.NotNil(t, n)
+	require.Equal(t, n, g.Node(n.ID()))
+	require.Equal(t, "document#viewer", g.reverseMapping[n.ID()])
+
+	g.AddEdge("document#owner", "document#viewer", computedEdge, "", "")
+	require.Len(t, g.SortedLines(), 2)
+}
+
+func TestRemoveNodesWithNoEdges_WildcardOnly(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type folder
+		type document
+			relations
+				define viewer: [user, folder:*]`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions())
+	removed := g.RemoveNodesWithNoEdges()
+
+	// folder is only referenced through its wildcard, so its plain node is
+	// removed while its wildcard node is kept
+	require.Contains(t, removed, "folder")
+	require.NotContains(t, removed, "folder:*")
+	require.Equal(t, []string{"document#viewer", "folder:*", "user"}, g.NodeLabels())
+}
+
+func TestUseLabelIDs(t *testing.T) {
+	g := newDotEncodingGraph()
+	for _, label := range []string{"document#viewer", "user:*", "user_wildcard", "user[with condition1]", "operator", "document#viewer/0-but not"} {
+		g.AddOrGetNode(label)
+	}
+	g.UseLabelIDs()
+
+	ids := map[string]string{}
+	for _, n := range g.SortedNodes() {
+		ids[g.reverseMapping[n.ID()]] = n.DOTID()
+	}
+	// colliding IDs are numbered in the order of the labels, and so are the
+	// IDs of the nodes of the legend
+	require.Equal(t, map[string]string{
+		"document#viewer":           "document_viewer",
+		"document#viewer/0-but not": "document_viewer_0_but_not",
+		"operator":                  "operator_2",
+		"user:*":                    "user_wildcard",
+		"user[with condition1]":     "user_with_condition1",
+		"user_wildcard":             "user_wildcard_2",
+	}, ids)
+}
+
+func TestEdgeList(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user]
+				define viewer: editor and viewer from parent`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions())
+	g.RemoveNodesWithNoEdges()
+	g.NumberEdges()
+
+	require.Equal(t, []EdgeInfo{
+		{From: "user", To: "document#editor", Label: "1", Weight: 1, Kind: "direct assignment"},
+		{From: "folder", To: "document#parent", Label: "2", Weight: 1, Kind: "direct assignment"},
+		{From: "document#editor", To: "document#viewer", Label: "3", Style: "dashed", Weight: 1, Kind: "computed userset"},
+		{From: "folder#viewer", To: "document#viewer", Label: "4", HeadLabel: "(viewer from document#parent)", Weight: 2, Kind: "tuple to userset"},
+		{From: "user", To: "folder#viewer", Label: "5", Weight: 1, Kind: "direct assignment"},
+	}, g.EdgeList())
+}
+
+func TestNodeLabels(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: viewer from parent`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions())
+	require.Equal(t, []string{
+		"document", "document#parent", "document#viewer", "document:*",
+		"folder", "folder#viewer", "folder:*",
+		"user", "user:*",
+	}, g.NodeLabels())
+
+	g.RemoveNodesWithNoEdges()
+	require.Equal(t, []string{"document#parent", "document#viewer", "folder", "folder#viewer", "user"}, g.NodeLabels())
+}
+
+func TestSortedNodes(t *testing.T) {
+	g := newDotEncodingGraph()
+	for _, label := range []string{"user", "group#member", "document#viewer", "group", "document#owner"} {
+		g.AddOrGetNode(label)
+	}
+
+	var labels []string
+	for _, n := range g.SortedNodes() {
+		labels = append(labels, g.reverseMapping[n.ID()])
+	}
+	require.Equal(t, []string{"document#owner", "document#viewer", "group", "group#member", "user"}, labels)
+}
+
+func TestAttributes_SkipsEmptyValues(t *testing.T) {
+	g := newDotEncodingGraph()
+	n := g.AddOrGetNode("document#viewer").(*dotNode)
+	n.attrs["tooltip"] = ""
+	require.Equal(t, []encoding.Attribute{{Key: "label", Value: "document#viewer"}}, n.Attributes())
+
+	l := g.AddEdge("user", "document#viewer", directEdge, "", "")
+	l.attrs["label"] = "1"
+	l.attrs["headlabel"] = ""
+	l.attrs["style"] = ""
+	require.Equal(t, []encoding.Attribute{{Key: "label", Value: "1"}}, l.Attributes())
+}
+
+func TestHighlight(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define owner: [user]
+				define editor: [user, group#member] or owner
+				define viewer: editor or viewer from parent
+				define can_delete: owner`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions())
+	g.RemoveNodesWithNoEdges()
+
+	// everything the relation is derived from, through operator nodes, but
+	// not the relations derived from it, such as document#viewer
+	require.Equal(t, []string{
+		"document#editor", "document#editor/0-or", "document#owner", "group#member", "user",
+	}, g.Highlight("document#editor"))
+
+	for _, n := range g.SortedNodes() {
+		label := g.reverseMapping[n.ID()]
+		switch label {
+		case "document#editor":
+			require.Equal(t, "red", n.attrs["color"])
+			require.Equal(t, "2", n.attrs["penwidth"])
+		case "document#editor/0-or", "document#owner", "group#member", "user":
+			require.Equal(t, "2", n.attrs["penwidth"], label)
+			require.NotEqual(t, "gray", n.attrs["color"], label)
+		default:
+			require.Equal(t, "gray", n.attrs["color"], label)
+		}
+	}
+
+	for _, l := range g.SortedLines() {
+		description := g.describeLine(l)
+		if g.relationOf(l.To()) == "document#editor" || g.reverseMapping[l.To().ID()] == "group#member" || g.reverseMapping[l.To().ID()] == "document#owner" {
+			require.Equal(t, "2", l.attrs["penwidth"], description)
+		} else {
+			require.Equal(t, "gray", l.attrs["color"], description)
+		}
+	}
+}
+
+func TestGrantedUserTypes(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type bot
+		type group
+			relations
+				define member: [user, bot:*, group#member]
+		type folder
+			relations
+				define viewer: [user with condition1]
+		type document
+			relations
+				define parent: [folder]
+				define owner: [user]
+				define viewer: [group#member] or owner or viewer from parent
+
+		condition condition1(x: int) {
+			x < 100
+		}`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions())
+	g.RemoveNodesWithNoEdges()
+
+	// wildcards and conditioned users count as their type, and are found
+	// through usersets, computed usersets and tuple to usersets
+	require.Equal(t, []string{"bot", "user"}, g.GrantedUserTypes("group#member"))
+	require.Equal(t, []string{"user"}, g.GrantedUserTypes("folder#viewer"))
+	require.Equal(t, []string{"bot", "user"}, g.GrantedUserTypes("document#viewer"))
+	// the objects of a tupleset are granted it, but not what is rewritten
+	// through it
+	require.Equal(t, []string{"folder"}, g.GrantedUserTypes("document#parent"))
+
+	g.LabelClosureSizes()
+	require.Equal(t, `"document#viewer\n(2 user types)"`, g.Node(g.mapping["document#viewer"]).(*dotNode).attrs["label"])
+	require.Equal(t, `"document#owner\n(1 user type)"`, g.Node(g.mapping["document#owner"]).(*dotNode).attrs["label"])
+	require.Equal(t, `"document#parent\n(1 user type)"`, g.Node(g.mapping["document#parent"]).(*dotNode).attrs["label"])
+	require.Equal(t, "user", g.Node(g.mapping["user"]).(*dotNode).attrs["label"])
+}
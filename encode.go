@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+	"gonum.org/v1/gonum/graph/encoding/dot"
+)
+
+// writeDOT writes the DOT of the directed multigraph g to w as it is encoded,
+// instead of marshaling it whole first, so that the output of a large model
+// isn't held in memory. The output is the one of dot.MarshalMulti without a
+// prefix or indent, including the attributes, subgraphs and ports of the
+// graphs, nodes and lines implementing the interfaces of the dot package.
+func writeDOT(w io.Writer, g graph.Multigraph) error {
+	p := &dotPrinter{w: bufio.NewWriter(w)}
+	p.print(g, "", false)
+	return p.w.Flush()
+}
+
+// marshalDOT returns the DOT of the directed multigraph g, see writeDOT.
+func marshalDOT(g graph.Multigraph) (string, error) {
+	var sb strings.Builder
+	if err := writeDOT(&sb, g); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// dotPrinter writes DOT to a buffered writer, which records the first error
+// writing to the underlying writer and returns it when flushed.
+type dotPrinter struct {
+	w *bufio.Writer
+}
+
+// print writes the graph g, named name if it isn't empty, or a subgraph of
+// the graph being written if isSubgraph is true.
+func (p *dotPrinter) print(g graph.Multigraph, name string, isSubgraph bool) {
+	if name == "" {
+		if named, ok := g.(dot.Multigraph); ok {
+			name = named.DOTID()
+		}
+	}
+
+	if isSubgraph {
+		p.w.WriteString("subgraph")
+	} else {
+		p.w.WriteString("digraph")
+	}
+	if name != "" {
+		p.w.WriteByte(' ')
+		p.w.WriteString(quoteDOTID(name))
+	}
+	p.w.WriteString(" {")
+
+	if a, ok := g.(dot.Attributers); ok {
+		p.writeGraphAttributes(a)
+	}
+	if s, ok := g.(dot.MultiStructurer); ok {
+		for _, sub := range s.Structure() {
+			p.w.WriteByte('\n')
+			p.print(sub, sub.DOTID(), true)
+		}
+	}
+
+	nodes := graph.NodesOf(g.Nodes())
+	sortByID(nodes)
+	for i, n := range nodes {
+		if i == 0 {
+			p.w.WriteString("\n// Node definitions.")
+		}
+		p.w.WriteByte('\n')
+		p.w.WriteString(quoteDOTID(dotNodeID(n)))
+		if a, ok := n.(encoding.Attributer); ok {
+			p.writeAttributes(a)
+		}
+		p.w.WriteByte(';')
+	}
+
+	wroteEdgeHeader := false
+	for _, n := range nodes {
+		to := graph.NodesOf(g.From(n.ID()))
+		sortByID(to)
+		for _, t := range to {
+			lines := graph.LinesOf(g.Lines(n.ID(), t.ID()))
+			sort.Slice(lines, func(i, j int) bool {
+				return lines[i].ID() < lines[j].ID()
+			})
+			for _, l := range lines {
+				if !wroteEdgeHeader {
+					p.w.WriteString("\n\n// Edge definitions.")
+					wroteEdgeHeader = true
+				}
+				p.writeLine(n, t, l)
+			}
+		}
+	}
+
+	p.w.WriteString("\n}")
+}
+
+// writeLine writes the line l from the node from to the node to.
+func (p *dotPrinter) writeLine(from, to graph.Node, l graph.Line) {
+	porter, hasPorts := l.(dot.Porter)
+
+	p.w.WriteByte('\n')
+	p.w.WriteString(quoteDOTID(dotNodeID(from)))
+	if hasPorts {
+		p.writePort(porter.FromPort())
+	}
+	p.w.WriteString(" -> ")
+	p.w.WriteString(quoteDOTID(dotNodeID(to)))
+	if hasPorts {
+		p.writePort(porter.ToPort())
+	}
+	if a, ok := l.(encoding.Attributer); ok {
+		p.writeAttributes(a)
+	}
+	p.w.WriteByte(';')
+}
+
+// writePort writes the port and compass point a line is wired to, if any.
+func (p *dotPrinter) writePort(port, compass string) {
+	if port != "" {
+		p.w.WriteByte(':')
+		p.w.WriteString(quoteDOTID(port))
+	}
+	if compass != "" {
+		p.w.WriteByte(':')
+		p.w.WriteString(compass)
+	}
+}
+
+// writeAttributes writes the attribute list of a node or line, on one line if
+// it has a single attribute.
+func (p *dotPrinter) writeAttributes(a encoding.Attributer) {
+	attrs := a.Attributes()
+	switch len(attrs) {
+	case 0:
+	case 1:
+		fmt.Fprintf(p.w, " [%s=%s]", quoteDOTID(attrs[0].Key), quoteDOTID(attrs[0].Value))
+	default:
+		p.w.WriteString(" [")
+		p.writeAttributeLines(attrs)
+	}
+}
+
+// writeGraphAttributes writes the graph, node and edge attribute statements
+// of a graph, skipping the ones without attributes.
+func (p *dotPrinter) writeGraphAttributes(a dot.Attributers) {
+	graphAttrs, nodeAttrs, edgeAttrs := a.DOTAttributers()
+	wrote := false
+	for i, attributer := range []encoding.Attributer{graphAttrs, nodeAttrs, edgeAttrs} {
+		if attributer == nil {
+			continue
+		}
+		attrs := attributer.Attributes()
+		if len(attrs) == 0 {
+			continue
+		}
+		if wrote {
+			p.w.WriteByte(';')
+		}
+		fmt.Fprintf(p.w, "\n%s [", []string{"graph", "node", "edge"}[i])
+		p.writeAttributeLines(attrs)
+		wrote = true
+	}
+	if wrote {
+		p.w.WriteString(";\n")
+	}
+}
+
+// writeAttributeLines writes attrs one per line, followed by the closing
+// bracket of their list.
+func (p *dotPrinter) writeAttributeLines(attrs []encoding.Attribute) {
+	for _, attr := range attrs {
+		fmt.Fprintf(p.w, "\n%s=%s", quoteDOTID(attr.Key), quoteDOTID(attr.Value))
+	}
+	p.w.WriteString("\n]")
+}
+
+// sortByID sorts nodes by ID, the order the DOT encoder writes them in.
+func sortByID(nodes []graph.Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID() < nodes[j].ID()
+	})
+}
+
+// dotNodeID returns the DOT ID of the node n, see dot.Node, defaulting to its
+// numeric ID.
+func dotNodeID(n graph.Node) string {
+	if n, ok := n.(dot.Node); ok {
+		return n.DOTID()
+	}
+	return strconv.FormatInt(n.ID(), 10)
+}
+
+var (
+	dotIdentifier = regexp.MustCompile(`^[a-zA-Z\200-\377_][0-9a-zA-Z\200-\377_]*$`)
+	dotNumeral    = regexp.MustCompile(`^[-]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)$`)
+	dotKeywords   = []string{"node", "edge", "graph", "digraph", "subgraph", "strict"}
+)
+
+// quoteDOTID quotes s unless it already is a DOT ID: an identifier, a
+// numeral, a valid double-quoted string or an HTML string. Keywords are always
+// quoted.
+func quoteDOTID(s string) string {
+	for _, keyword := range dotKeywords {
+		if strings.EqualFold(s, keyword) {
+			return strconv.Quote(s)
+		}
+	}
+
+	if dotIdentifier.MatchString(s) || dotNumeral.MatchString(s) {
+		return s
+	}
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		if _, err := strconv.Unquote(s); err == nil {
+			return s
+		}
+	}
+	if len(s) >= 2 && strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">") {
+		return s
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding/dot"
+)
+
+const encodeTestModel = `
+	model
+		schema 1.1
+	type user
+	type node
+	type group
+		relations
+			define member: [user, user:*, group#member]
+	type document
+		relations
+			define blocked: [user]
+			define owner: [user, group#member]
+			define editor: [user] or owner
+			define viewer: (editor and owner) but not blocked
+			define graph: [node]`
+
+func TestWriteDOT_MatchesMarshalMulti(t *testing.T) {
+	model, err := parseModel(encodeTestModel)
+	require.NoError(t, err)
+
+	build := func(opts ...Option) *dotEncodingGraph {
+		o := newOptions(opts...)
+		g, _ := buildGraph(model, o)
+		g.RemoveNodesWithNoEdges()
+		return g
+	}
+
+	clustered := build(WithOperatorNodes())
+	clustered.clusterRewrites = true
+	clustered.legend = true
+	clustered.title = `the "document" model`
+	clustered.fontname = "Helvetica Neue"
+	clustered.theme = themes["dark"]
+	clustered.typeRanks = []typeRank{{typeName: "user", rank: "source"}}
+	clustered.NumberEdges()
+
+	records := build().RecordNodes()
+	records.NumberEdges()
+
+	labeled := build()
+	labeled.UseLabelIDs()
+	labeled.UseHTMLLabels()
+
+	for name, g := range map[string]graph.Multigraph{
+		"clusters":     clustered,
+		"record_nodes": records,
+		"label_ids":    labeled,
+		"side_by_side": &sideBySideGraph{dotEncodingGraph: clustered, titles: []string{"a", "b"}},
+		"empty":        newDotEncodingGraph(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			expected, err := dot.MarshalMulti(g, "", "", "")
+			require.NoError(t, err)
+
+			actual, err := marshalDOT(g)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), actual)
+		})
+	}
+}
+
+// recordingWriter records the size of every write, and fails once failAfter
+// writes succeeded if failAfter isn't 0.
+type recordingWriter struct {
+	strings.Builder
+	writes    []int
+	failAfter int
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.failAfter > 0 && len(w.writes) == w.failAfter {
+		return 0, errors.New("disk full")
+	}
+	w.writes = append(w.writes, len(p))
+	return w.Builder.Write(p)
+}
+
+func TestWriteTo_Streams(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("model\n  schema 1.1\ntype user\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&sb, "type document%d\n  relations\n    define viewer: [user]\n    define editor: [user] or viewer\n", i)
+	}
+	model := sb.String()
+
+	expected, _, err := Writer(model)
+	require.NoError(t, err)
+
+	// the graph is written in chunks as it is encoded, rather than in one
+	// write of the whole graph
+	w := &recordingWriter{}
+	_, err = WriteTo(w, model)
+	require.NoError(t, err)
+	require.Equal(t, expected, w.String())
+	require.Greater(t, len(w.writes), 1)
+	for _, size := range w.writes {
+		require.Less(t, size, len(expected))
+	}
+
+	w = &recordingWriter{failAfter: 1}
+	_, err = WriteTo(w, model)
+	require.EqualError(t, err, "failed to write graph: disk full")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// ExpansionTree returns the DOT of the rewrite of a single relation, given as
+// type#relation, drawn as a tree: every union, intersection and exclusion is
+// an operator node, and every direct assignment, computed userset and tuple to
+// userset is a leaf of its own, even if it occurs more than once. The leaves
+// are not expanded further, so the tree is the definition of the relation
+// rather than the graph of everything that grants it.
+func ExpansionTree(model *openfgav1.AuthorizationModel, relation string, opts ...Option) (string, error) {
+	o := newOptions(opts...)
+
+	typeName, relationName, ok := strings.Cut(relation, "#")
+	if !ok {
+		return "", fmt.Errorf("invalid relation %q: expected type#relation", relation)
+	}
+
+	typesys := typesystem.New(model)
+	rewrite, err := typesys.GetRelation(typeName, relationName)
+	if err != nil {
+		return "", fmt.Errorf("relation %s not found in the model", relation)
+	}
+
+	graphAttrs, err := graphAttributes(o)
+	if err != nil {
+		return "", err
+	}
+
+	t := &expansionTree{
+		model:        model,
+		typesys:      typesys,
+		typeName:     typeName,
+		relationName: relationName,
+		relation:     nodeLabel(typeName, relationName, false, ""),
+		g:            newDotEncodingGraph(),
+	}
+	t.g.AddOrGetNode(t.relation)
+	t.expand(rewrite.GetRewrite(), t.relation, 0)
+
+	if o.title {
+		t.g.title = modelTitle(model)
+	}
+	t.g.fontname = o.fontname
+	t.g.graphAttrs = graphAttrs
+	t.g.theme = themes[o.theme]
+
+	multi, err := marshalDOT(t.g)
+	if err != nil {
+		return "", fmt.Errorf("failed to render graph: %w", err)
+	}
+
+	if o.header {
+		header, err := generationHeader(model, o.headerTimestamp)
+		if err != nil {
+			return "", err
+		}
+		multi = header + multi
+	}
+
+	return multi, nil
+}
+
+// expansionTree holds the state shared while drawing the rewrite of a single
+// relation as a tree.
+type expansionTree struct {
+	model        *openfgav1.AuthorizationModel
+	typesys      *typesystem.TypeSystem
+	typeName     string
+	relationName string
+	relation     string // label of the relation whose rewrite is drawn
+	g            *dotEncodingGraph
+}
+
+// expand draws rewrite as a subtree feeding the node labeled parent, where
+// index is the position of rewrite among the children of parent. Every node of
+// the tree is keyed by its parent and this position, so that no two
+// occurrences of the same rewrite share a node.
+func (t *expansionTree) expand(rewrite *openfgav1.Userset, parent string, index int) {
+	key := fmt.Sprintf("%s/%d", parent, index)
+
+	switch rw := rewrite.Userset.(type) {
+	case *openfgav1.Userset_This:
+		t.addLeaf(key, t.describeDirect(), parent, directEdge)
+	case *openfgav1.Userset_ComputedUserset:
+		t.addLeaf(key, nodeLabel(t.typeName, rw.ComputedUserset.GetRelation(), false, ""), parent, computedEdge)
+	case *openfgav1.Userset_TupleToUserset:
+		description := fmt.Sprintf("%s from %s", rw.TupleToUserset.GetComputedUserset().GetRelation(), rw.TupleToUserset.GetTupleset().GetRelation())
+		t.addLeaf(key, description, parent, tupleToUsersetEdge)
+	case *openfgav1.Userset_Union:
+		t.expandOperator("or", rw.Union.GetChild(), key, parent)
+	case *openfgav1.Userset_Intersection:
+		t.expandOperator("and", rw.Intersection.GetChild(), key, parent)
+	case *openfgav1.Userset_Difference:
+		t.expandOperator("but not", []*openfgav1.Userset{rw.Difference.GetBase(), rw.Difference.GetSubtract()}, key, parent)
+	default:
+		panic("unexpected userset rewrite type encountered")
+	}
+}
+
+// expandOperator draws an operator node keyed key feeding parent, and the
+// subtrees of its children feeding the operator node. The subtracted operand
+// of an exclusion is marked like in the graph of the model.
+func (t *expansionTree) expandOperator(operator string, children []*openfgav1.Userset, key, parent string) {
+	depth := t.g.Node(t.g.mapping[parent]).(*dotNode).depth + 1
+	t.g.AddOperatorNode(key, operator, t.relation, depth)
+	t.g.AddEdge(key, parent, operatorEdge, "", "")
+
+	for i, child := range children {
+		added := t.g.edgeCounter
+		t.expand(child, key, i)
+
+		if operator == "but not" && i == 1 {
+			t.g.markSubtracted(key, added)
+		}
+	}
+}
+
+// addLeaf draws a leaf keyed key and labeled label feeding parent, with an
+// edge styled like the edges of the given kind in the graph of the model.
+func (t *expansionTree) addLeaf(key, label, parent string, kind edgeKind) {
+	t.g.AddOrGetNode(key).(*dotNode).attrs["label"] = label
+	t.g.AddEdge(key, parent, kind, "", "")
+}
+
+// describeDirect describes the direct assignments of the relation the way
+// they are written in the DSL, e.g. "[user, group#member]".
+func (t *expansionTree) describeDirect() string {
+	if t.model.GetSchemaVersion() == typesystem.SchemaVersion1_0 {
+		return fmt.Sprintf("[%s]", anyUserNodeName)
+	}
+
+	relatedTypes, err := t.typesys.GetDirectlyRelatedUserTypes(t.typeName, t.relationName)
+	if err != nil {
+		panic(err)
+	}
+
+	descriptions := make([]string, 0, len(relatedTypes))
+	for _, relatedType := range relatedTypes {
+		descriptions = append(descriptions, describeRelatedType(relatedType))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(descriptions, ", "))
+}
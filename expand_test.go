@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+)
+
+const expandTestModel = `
+	model
+		schema 1.1
+	type user
+	type folder
+		relations
+			define viewer: [user]
+	type document
+		relations
+			define parent: [folder]
+			define blocked: [user]
+			define owner: [user]
+			define editor: [user] or owner
+			define viewer: ([user, user:*] or editor) and (viewer from parent but not blocked)
+			define can_share: owner or (editor and owner)`
+
+func TestExpansionTree(t *testing.T) {
+	testCases := map[string]struct {
+		relation    string
+		expectedDOT string
+	}{
+		`direct`: {
+			relation: "document#owner",
+			expectedDOT: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label="document#owner"];
+1 [label="[user]"];
+
+// Edge definitions.
+1 -> 0;
+}`,
+		},
+		`nested_operators`: {
+			relation: "document#viewer",
+			expectedDOT: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label="document#viewer"];
+1 [
+label=and
+shape=diamond
+];
+2 [
+label=or
+shape=diamond
+];
+3 [label="[user, user:*]"];
+4 [label="document#editor"];
+5 [
+label="but not"
+shape=diamond
+];
+6 [label="viewer from parent"];
+7 [label="document#blocked"];
+
+// Edge definitions.
+1 -> 0;
+2 -> 1;
+3 -> 2;
+4 -> 2 [style=dashed];
+5 -> 1;
+6 -> 5;
+7 -> 5 [
+arrowhead=tee
+style=dashed
+];
+}`,
+		},
+		`repeated_operand`: {
+			relation: "document#can_share",
+			expectedDOT: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label="document#can_share"];
+1 [
+label=or
+shape=diamond
+];
+2 [label="document#owner"];
+3 [
+label=and
+shape=diamond
+];
+4 [label="document#editor"];
+5 [label="document#owner"];
+
+// Edge definitions.
+1 -> 0;
+2 -> 1 [style=dashed];
+3 -> 1;
+4 -> 3 [style=dashed];
+5 -> 3 [style=dashed];
+}`,
+		},
+	}
+
+	model, err := parseModel(expandTestModel)
+	require.NoError(t, err)
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actualDOT, err := ExpansionTree(model, testCase.relation)
+			require.NoError(t, err)
+			require.Empty(t, cmp.Diff(getSorted(testCase.expectedDOT), getSorted(actualDOT)), actualDOT)
+		})
+	}
+}
+
+func TestExpansionTree_Errors(t *testing.T) {
+	model, err := parseModel(expandTestModel)
+	require.NoError(t, err)
+
+	_, err = ExpansionTree(model, "document")
+	require.ErrorContains(t, err, `invalid relation "document": expected type#relation`)
+
+	_, err = ExpansionTree(model, "document#commenter")
+	require.ErrorContains(t, err, "relation document#commenter not found in the model")
+}
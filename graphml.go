@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph/encoding"
+)
+
+// graphMLNamespace is the XML namespace of GraphML documents.
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+// graphML is a GraphML document, as read by tools like yEd or Gephi. The
+// attributes of the graph, its nodes and its edges are written as data with a
+// key per attribute name, e.g. "node.label", holding the same values as in the
+// DOT output, so that they can be read back as they were written.
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphMLData `xml:"data"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID    string        `xml:"id,attr"`
+	Data  []graphMLData `xml:"data"`
+	Ports []graphMLPort `xml:"port"`
+}
+
+type graphMLPort struct {
+	Name string `xml:"name,attr"`
+}
+
+type graphMLEdge struct {
+	ID         string        `xml:"id,attr"`
+	Source     string        `xml:"source,attr"`
+	Target     string        `xml:"target,attr"`
+	SourcePort string        `xml:"sourceport,attr,omitempty"`
+	TargetPort string        `xml:"targetport,attr,omitempty"`
+	Data       []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLKeys collects the keys of the attributes written for one kind of
+// element, e.g. "node".
+type graphMLKeys struct {
+	kind  string
+	names map[string]bool
+}
+
+// data returns the data of attrs, registering the key of every attribute.
+func (k *graphMLKeys) data(attrs []encoding.Attribute) []graphMLData {
+	data := make([]graphMLData, 0, len(attrs))
+	for _, attr := range attrs {
+		k.names[attr.Key] = true
+		data = append(data, graphMLData{Key: k.kind + "." + attr.Key, Value: attr.Value})
+	}
+	return data
+}
+
+func (k *graphMLKeys) keys() []graphMLKey {
+	names := make([]string, 0, len(k.names))
+	for name := range k.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keys := make([]graphMLKey, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, graphMLKey{ID: k.kind + "." + name, For: k.kind, Name: name, Type: "string"})
+	}
+	return keys
+}
+
+// WriteGraphML writes the graph to w as a GraphML document. Nodes are written
+// in the order of their IDs and edges in the order they were added, as in the
+// DOT output. The legend and the clusters of rewrites only have a meaning in
+// graphviz, so they aren't written.
+func (g *dotEncodingGraph) WriteGraphML(w io.Writer) error {
+	graphKeys := &graphMLKeys{kind: "graph", names: map[string]bool{}}
+	nodeKeys := &graphMLKeys{kind: "node", names: map[string]bool{}}
+	edgeKeys := &graphMLKeys{kind: "edge", names: map[string]bool{}}
+
+	doc := graphML{
+		Xmlns: graphMLNamespace,
+		Graph: graphMLGraph{
+			ID:          "G",
+			EdgeDefault: "directed",
+			Data:        graphKeys.data(g.Attributes()),
+		},
+	}
+
+	nodeID := func(id int64) string {
+		return fmt.Sprintf("n%d", id)
+	}
+
+	lines := g.SortedLines()
+	ports := map[int64]map[string]bool{}
+	for _, l := range lines {
+		for _, end := range []struct {
+			id   int64
+			port string
+		}{{l.From().ID(), l.fromPort}, {l.To().ID(), l.toPort}} {
+			if end.port == "" {
+				continue
+			}
+			if ports[end.id] == nil {
+				ports[end.id] = map[string]bool{}
+			}
+			ports[end.id][end.port] = true
+		}
+	}
+
+	nodes := g.SortedNodes()
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID() < nodes[j].ID()
+	})
+	for _, n := range nodes {
+		node := graphMLNode{ID: nodeID(n.ID()), Data: nodeKeys.data(n.Attributes())}
+		names := make([]string, 0, len(ports[n.ID()]))
+		for name := range ports[n.ID()] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			node.Ports = append(node.Ports, graphMLPort{Name: name})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+	}
+
+	for i, l := range lines {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			ID:         fmt.Sprintf("e%d", i),
+			Source:     nodeID(l.From().ID()),
+			Target:     nodeID(l.To().ID()),
+			SourcePort: l.fromPort,
+			TargetPort: l.toPort,
+			Data:       edgeKeys.data(l.Attributes()),
+		})
+	}
+
+	doc.Keys = append(doc.Keys, graphKeys.keys()...)
+	doc.Keys = append(doc.Keys, nodeKeys.keys()...)
+	doc.Keys = append(doc.Keys, edgeKeys.keys()...)
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// graphMLHeader turns the "//" comment lines of a DOT header into XML
+// comments.
+func graphMLHeader(header string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(header, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "<!-- %s -->\n", strings.TrimPrefix(line, "// "))
+	}
+	return sb.String()
+}
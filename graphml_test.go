@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_GraphML(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user]
+				define viewer: [user with condition1] or editor
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	actual, _, err := Writer(model, WithOutputFormat(formatGraphML))
+	require.NoError(t, err)
+
+	expected := `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="graph.rankdir" for="graph" attr.name="rankdir" attr.type="string"></key>
+  <key id="node.label" for="node" attr.name="label" attr.type="string"></key>
+  <key id="node.shape" for="node" attr.name="shape" attr.type="string"></key>
+  <key id="edge.label" for="edge" attr.name="label" attr.type="string"></key>
+  <key id="edge.style" for="edge" attr.name="style" attr.type="string"></key>
+  <graph id="G" edgedefault="directed">
+    <data key="graph.rankdir">BT</data>
+    <node id="n2">
+      <data key="node.label">document#editor</data>
+    </node>
+    <node id="n3">
+      <data key="node.label">user</data>
+    </node>
+    <node id="n4">
+      <data key="node.label">document#viewer</data>
+    </node>
+    <node id="n5">
+      <data key="node.label">or</data>
+      <data key="node.shape">diamond</data>
+    </node>
+    <node id="n6">
+      <data key="node.label">user[with condition1]</data>
+    </node>
+    <edge id="e0" source="n3" target="n2">
+      <data key="edge.label">1</data>
+    </edge>
+    <edge id="e1" source="n5" target="n4">
+      <data key="edge.label">2</data>
+    </edge>
+    <edge id="e2" source="n6" target="n5">
+      <data key="edge.label">3</data>
+    </edge>
+    <edge id="e3" source="n2" target="n5">
+      <data key="edge.label">4</data>
+      <data key="edge.style">dashed</data>
+    </edge>
+  </graph>
+</graphml>
+`
+	require.Equal(t, expected, actual)
+}
+
+func TestWriteGraphML_RoundTrip(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type document
+			relations
+				define editor: [user, group#member]
+				define viewer: editor but not owner
+				define owner: [user]`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions(WithOperatorNodes()))
+	g.RemoveNodesWithNoEdges()
+	g = g.RecordNodes()
+	g.NumberEdges()
+	g.title = `the "document" model`
+
+	var marshaled bytes.Buffer
+	require.NoError(t, g.WriteGraphML(&marshaled))
+
+	var doc graphML
+	require.NoError(t, xml.Unmarshal(marshaled.Bytes(), &doc))
+
+	// every attribute is read back as it was written, with a key declared
+	// for it
+	keys := map[string]bool{}
+	for _, key := range doc.Keys {
+		keys[key.ID] = true
+	}
+	read := func(data []graphMLData) map[string]string {
+		attrs := map[string]string{}
+		for _, d := range data {
+			require.True(t, keys[d.Key], d.Key)
+			kind, name, _ := strings.Cut(d.Key, ".")
+			attrs[kind+":"+name] = d.Value
+		}
+		return attrs
+	}
+	written := func(kind string, attrs map[string]string) map[string]string {
+		prefixed := map[string]string{}
+		for k, v := range attrs {
+			if v != "" {
+				prefixed[kind+":"+k] = v
+			}
+		}
+		return prefixed
+	}
+
+	require.Equal(t, `the "document" model`, read(doc.Graph.Data)["graph:label"])
+
+	require.Len(t, doc.Graph.Nodes, g.Nodes().Len())
+	for _, n := range doc.Graph.Nodes {
+		var id int64
+		_, err := fmt.Sscanf(n.ID, "n%d", &id)
+		require.NoError(t, err)
+		require.Equal(t, written("node", g.Node(id).(*dotNode).attrs), read(n.Data))
+	}
+
+	lines := g.SortedLines()
+	require.Len(t, doc.Graph.Edges, len(lines))
+	for i, e := range doc.Graph.Edges {
+		l := lines[i]
+		require.Equal(t, written("edge", l.attrs), read(e.Data))
+		require.Equal(t, l.fromPort, e.SourcePort)
+		require.Equal(t, l.toPort, e.TargetPort)
+	}
+
+	// the ports edges are wired to are declared by their nodes
+	var documentPorts []string
+	for _, n := range doc.Graph.Nodes {
+		if read(n.Data)["node:label"] == `"{document|<editor> editor|<owner> owner|<viewer> viewer}"` {
+			for _, p := range n.Ports {
+				documentPorts = append(documentPorts, p.Name)
+			}
+		}
+	}
+	require.Equal(t, []string{"editor", "owner", "viewer"}, documentPorts)
+}
+
+func TestWriter_GraphMLHeader(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`
+
+	actual, _, err := Writer(model, WithOutputFormat(formatGraphML), WithHeader(false))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(actual, "<!-- generated by openfga-graphviz-gen -->\n<!-- model sha256: "), actual)
+	require.NoError(t, xml.Unmarshal([]byte(actual), &graphML{}))
+}
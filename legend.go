@@ -0,0 +1,73 @@
+package main
+
+import (
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+	"gonum.org/v1/gonum/graph/encoding/dot"
+)
+
+// legendEntries are the edge styles explained by the legend, in the order
+// they are listed.
+var legendEntries = []struct {
+	description string
+	attrs       map[string]string
+}{
+	{"direct assignment", map[string]string{}},
+	{"computed userset", map[string]string{"style": "dashed"}},
+	{"tuple to userset", map[string]string{"headlabel": "(relation from type#tupleset)"}},
+	{"self reference", map[string]string{"color": "blue"}},
+	{"subtracted (but not)", map[string]string{"arrowhead": "tee"}},
+}
+
+// newLegend returns a cluster explaining the styles of the edges and the
+// operator nodes. It only exists in the marshaled graph, so that it doesn't
+// take part in cycle detection or any other analysis of the model.
+func newLegend() *dotCluster {
+	legend := newDotCluster("cluster_legend", encoding.Attribute{Key: "label", Value: "legend"})
+
+	node := func(id string, attrs map[string]string) graph.Node {
+		n := &legendNode{Node: legend.NewNode(), id: id, attrs: attrs}
+		legend.AddNode(n)
+		return n
+	}
+
+	for _, entry := range legendEntries {
+		from := node(entry.description+" from", map[string]string{"label": "", "shape": "point"})
+		to := node(entry.description, map[string]string{"label": entry.description, "shape": "plaintext"})
+
+		l := &dotLine{Line: legend.NewLine(from, to), attrs: map[string]string{}}
+		for k, v := range entry.attrs {
+			l.attrs[k] = v
+		}
+		legend.SetLine(l)
+	}
+
+	node("operator", map[string]string{"label": "operator (or, and, but not)", "shape": "diamond"})
+
+	return legend
+}
+
+var (
+	_ dot.Node            = (*legendNode)(nil)
+	_ encoding.Attributer = (*legendNode)(nil)
+)
+
+// legendNode is a node of the legend. It has its own DOT ID so that it can't
+// clash with the nodes of the graph.
+type legendNode struct {
+	graph.Node
+	id    string
+	attrs map[string]string
+}
+
+func (n *legendNode) DOTID() string {
+	return n.id
+}
+
+func (n *legendNode) Attributes() []encoding.Attribute {
+	var attrs []encoding.Attribute
+	for _, k := range sortedKeys(n.attrs) {
+		attrs = append(attrs, encoding.Attribute{Key: k, Value: n.attrs[k]})
+	}
+	return attrs
+}
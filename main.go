@@ -1,34 +1,675 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 func main() {
-	modelPathFlag := flag.String("model-path", "", "the file path for the OpenFGA model (in DSL format)")
+	var modelPathFlag listFlag
+	flag.Var(&modelPathFlag, "model-path", "the file path for the OpenFGA model (in DSL format), a directory or fga.mod manifest of a modular model, a .json store export, or an http(s) URL of a DSL file (repeatable or comma-separated, to combine models into one graph)")
+	modelIDFlag := flag.String("model-id", "", "the ID of the model to render from a -model-path store export with several models")
 	outputPathFlag := flag.String("output-path", "", "the file path for the output graph (default to stdout)")
+	alsoStdoutFlag := flag.Bool("also-stdout", false, "write the graph to stdout as well as to -output-path")
+	diffAgainstFlag := flag.String("diff-against", "", "the file path of an older version of the model; renders the differences between the two")
+	sideBySideFlag := flag.String("side-by-side", "", "the file path of an older version of the model; renders both graphs next to each other, as two clusters")
+	serveFlag := flag.String("serve", "", "serve graphs on this address instead, e.g. :8080, for the model DSL posted to /graph")
+	cacheSizeFlag := flag.Int("cache-size", defaultCacheSize, "the number of graphs cached by -serve (0 to disable the cache)")
+	watchFlag := flag.Bool("watch", false, "regenerate the graph every time the model file, or a module file of a modular model, changes")
+	dumpModelFlag := flag.Bool("dump-model", false, "write the model the graph is built from as protojson instead of the graph, for debugging")
+	validateFlag := flag.Bool("validate", false, "only check that the model parses and report its cycles, without writing the graph")
+	failOnCyclesFlag := flag.Bool("fail-on-cycles", false, "exit with a non-zero status if the model has definitive cycles, which OpenFGA rejects; possible cycles only warn")
+	keepIsolatedFlag := flag.Bool("keep-isolated", false, "keep the types and relations that have no edges as standalone nodes, for a complete inventory of the model")
+	cyclesOnlyFlag := flag.Bool("cycles-only", false, "render only the nodes and edges that form cycles")
+	selfUsersetsFlag := flag.Bool("self-usersets", false, "report relations assignable to their own userset, e.g. define viewer: [document#viewer], as notices")
+	numberCyclesFlag := flag.Bool("number-cycles", false, "list the cycles of the model numbered and, with -highlight, color every cycle distinctly with a legend of their numbers")
+	collapseConditionsFlag := flag.Bool("collapse-conditions", false, "draw one node per type and label edges with their conditions instead")
+	conditionParamsFlag := flag.Bool("condition-params", false, "add the parameters of their condition to the labels of conditioned nodes, e.g. user[with condition1(x: int)]")
+	noConditionsFlag := flag.Bool("no-conditions", false, "leave conditions out, merging conditioned and unconditioned assignments of a type")
+	tooltipsFlag := flag.Bool("tooltips", false, "add tooltips describing the rewrite of every edge (shown in SVG output)")
+	operatorNodesFlag := flag.Bool("operator-nodes", false, "draw outermost intersections and exclusions as operator nodes too, like unions and nested operators")
+	titleFlag := flag.Bool("title", false, "label the graph with the schema version and ID of the model")
+	reverseFlag := flag.Bool("reverse", false, "point edges from each relation to what it grants, instead of to what grants it")
+	quietFlag := flag.Bool("quiet", false, "write nothing to stderr, neither warnings and summaries nor errors, which are then only reported by a non-zero exit status")
+	timestampFlag := flag.Bool("timestamp", false, "record the generation time in the output header, at the cost of the output no longer being reproducible")
+	fontnameFlag := flag.String("fontname", "", "the font of all text in the graph (default to the graphviz default)")
+	themeFlag := flag.String("theme", "", "color the graph with a preset: light or dark (default to the graphviz defaults)")
+	maxNodesFlag := flag.Int("max-nodes", 0, "truncate the graph to at most this many nodes (0 for no limit)")
+	maxEdgesFlag := flag.Int("max-edges", 0, "truncate the graph to at most this many edges (0 for no limit)")
+	inlineAssignableFlag := flag.Bool("inline-assignable", false, "list the directly related user types of every relation in the label of its node")
+	summaryFlag := flag.Bool("summary", false, "draw one node per type and the dependencies between types, instead of relations")
+	summaryCountsFlag := flag.Bool("summary-counts", false, "label every edge of -summary with the number of relation edges it aggregates")
+	splitByTypeFlag := flag.Bool("split-by-type", false, "write one graph per type, named after the type, into the directory given by -output-path")
+	htmlLabelsFlag := flag.Bool("html-labels", false, "bold the type prefix of relation labels with HTML-like labels, for renderers that support them")
+	weightsFlag := flag.Bool("weights", false, "add the ListObjects weight of every edge as its fga_weight attribute")
+	dpiFlag := flag.Float64("dpi", 0, "the resolution of rendered images, in dots per inch (default to the graphviz default)")
+	sizeFlag := flag.String("size", "", "the maximum size of rendered images as width[,height] in inches, e.g. 7.5,10 (a trailing ! scales smaller graphs up)")
+	tuplesetHopsFlag := flag.Bool("tupleset-hops", false, "draw every tuple to userset as two hops through the node of its tupleset relation")
+	highlightFlag := flag.String("highlight", "", "emphasize this type#relation and everything it is derived from, graying out the rest")
+	closureSizesFlag := flag.Bool("closure-sizes", false, "add to the label of every relation the number of user types that can ultimately be granted it")
+	wildcardLabelFlag := flag.String("wildcard-label", "", "display wildcard nodes as this text, with {type} replaced by the type, e.g. \"{type} (public)\" (default to user:*)")
+	ttuLabelFlag := flag.String("ttu-label", "", "display the head labels of tuple to userset edges as this text, with {relation}, {type} and {tupleset} replaced, e.g. \"from {tupleset}\" (default to ({relation} from {type}#{tupleset}))")
+	typeShapesFlag := flag.Bool("type-shapes", false, "draw type and wildcard nodes as boxes and relation nodes as ellipses, for grayscale or printed diagrams")
+	recordNodesFlag := flag.Bool("record-nodes", false, "draw every type as a record node with a field per relation, wiring edges to the fields")
+	labelIDsFlag := flag.Bool("label-ids", false, "identify nodes in the DOT output by IDs derived from their labels, e.g. document_viewer, instead of by numbers")
+	sortedEdgesFlag := flag.Bool("sorted-edges", false, "write nodes and edges sorted by label, for stable diffs of the output")
+	legendFlag := flag.Bool("legend", false, "add a legend explaining the styles of the edges and the operator nodes")
+	outputFormatFlag := flag.String("output-format", formatDOT, "the output format: dot, dot-cluster-by-rewrite, graphml, csv or matrix")
+	expandFlag := flag.String("expand", "", "render only the rewrite of this type#relation, as a tree of its operators and operands")
+	var relationsFlag listFlag
+	flag.Var(&relationsFlag, "relations", "render only these type#relation nodes and their immediate neighbors (repeatable or comma-separated)")
+	var graphAttrFlag repeatedFlag
+	flag.Var(&graphAttrFlag, "graph-attr", "a graphviz graph attribute as key=value, e.g. bgcolor=white (repeatable)")
+	var rankTypeFlag listFlag
+	flag.Var(&rankTypeFlag, "rank-type", "pin the nodes of a type to a graphviz rank as type=rank, with rank one of same, min, max, source or sink, e.g. user=source (repeatable or comma-separated)")
+	var hideUserTypeFlag, onlyTypesFlag listFlag
+	flag.Var(&hideUserTypeFlag, "hide-user-type", "drop the edges drawn from concrete users of these types (repeatable or comma-separated)")
+	flag.Var(&onlyTypesFlag, "only-types", "keep only the edges drawn from concrete users of these types, and from relations (repeatable or comma-separated)")
 
 	flag.Parse()
+	if *quietFlag {
+		// log.Fatalf still exits with a non-zero status, only its message is
+		// discarded
+		log.SetOutput(io.Discard)
+	}
+
+	opts := []Option{WithHeader(*timestampFlag)}
+	if *cyclesOnlyFlag {
+		opts = append(opts, WithCyclesOnly())
+	}
+	if *keepIsolatedFlag {
+		opts = append(opts, WithKeepIsolated())
+	}
+	if *collapseConditionsFlag {
+		opts = append(opts, WithCollapsedConditions())
+	}
+	if *noConditionsFlag {
+		opts = append(opts, WithoutConditions())
+	}
+	if *conditionParamsFlag {
+		opts = append(opts, WithConditionParams())
+	}
+	if *tooltipsFlag {
+		opts = append(opts, WithTooltips())
+	}
+	if *operatorNodesFlag {
+		opts = append(opts, WithOperatorNodes())
+	}
+	if *titleFlag {
+		opts = append(opts, WithTitle())
+	}
+	if *reverseFlag {
+		opts = append(opts, WithReverse())
+	}
+	if *fontnameFlag != "" {
+		opts = append(opts, WithFontname(*fontnameFlag))
+	}
+	if *themeFlag != "" {
+		opts = append(opts, WithTheme(*themeFlag))
+	}
+	if *maxNodesFlag > 0 {
+		opts = append(opts, WithMaxNodes(*maxNodesFlag))
+	}
+	if *maxEdgesFlag > 0 {
+		opts = append(opts, WithMaxEdges(*maxEdgesFlag))
+	}
+	if *inlineAssignableFlag {
+		opts = append(opts, WithInlineAssignable())
+	}
+	if len(graphAttrFlag) > 0 {
+		opts = append(opts, WithGraphAttributes(graphAttrFlag...))
+	}
+	if *summaryFlag {
+		opts = append(opts, WithTypeSummary())
+	}
+	if *summaryCountsFlag {
+		opts = append(opts, WithSummaryCounts())
+	}
+	if *legendFlag {
+		opts = append(opts, WithLegend())
+	}
+	if *htmlLabelsFlag {
+		opts = append(opts, WithHTMLLabels())
+	}
+	if *weightsFlag {
+		opts = append(opts, WithWeights())
+	}
+	if *tuplesetHopsFlag {
+		opts = append(opts, WithTuplesetHops())
+	}
+	if *highlightFlag != "" {
+		opts = append(opts, WithHighlight(*highlightFlag))
+	}
+	if *numberCyclesFlag {
+		opts = append(opts, WithNumberedCycles())
+	}
+	if *selfUsersetsFlag {
+		opts = append(opts, WithSelfUsersetNotices())
+	}
+	if *closureSizesFlag {
+		opts = append(opts, WithClosureSizes())
+	}
+	if *wildcardLabelFlag != "" {
+		opts = append(opts, WithWildcardLabel(*wildcardLabelFlag))
+	}
+	if *ttuLabelFlag != "" {
+		opts = append(opts, WithTuplesetLabel(*ttuLabelFlag))
+	}
+	if *typeShapesFlag {
+		opts = append(opts, WithTypeShapes())
+	}
+	if *recordNodesFlag {
+		opts = append(opts, WithRecordNodes())
+	}
+	if *labelIDsFlag {
+		opts = append(opts, WithLabelIDs())
+	}
+	if *sortedEdgesFlag {
+		opts = append(opts, WithSortedEdges())
+	}
+	if *dpiFlag != 0 {
+		opts = append(opts, WithDPI(*dpiFlag))
+	}
+	if *sizeFlag != "" {
+		opts = append(opts, WithSize(*sizeFlag))
+	}
+	opts = append(opts, WithOutputFormat(*outputFormatFlag))
+	if len(relationsFlag) > 0 {
+		opts = append(opts, WithRelations(relationsFlag...))
+	}
+	if len(rankTypeFlag) > 0 {
+		opts = append(opts, WithTypeRanks(rankTypeFlag...))
+	}
+	if len(hideUserTypeFlag) > 0 {
+		opts = append(opts, WithHiddenUserTypes(hideUserTypeFlag...))
+	}
+	if len(onlyTypesFlag) > 0 {
+		opts = append(opts, WithOnlyUserTypes(onlyTypesFlag...))
+	}
+
+	if *modelIDFlag != "" && !slices.ContainsFunc(modelPathFlag, isStoreExportPath) {
+		log.Fatalf("-model-id requires -model-path to be a store export (%s)", storeExportExtension)
+	}
+	if *alsoStdoutFlag && (*outputPathFlag == "" || *outputPathFlag == "-") {
+		log.Fatalf("-also-stdout requires -output-path to be a file")
+	}
+	if *sideBySideFlag != "" && *diffAgainstFlag != "" {
+		log.Fatalf("-side-by-side can't be combined with -diff-against")
+	}
+	if *alsoStdoutFlag && *splitByTypeFlag {
+		log.Fatalf("-also-stdout can't be combined with -split-by-type")
+	}
+
+	if *serveFlag != "" {
+		log.Printf("serving graphs on %s", *serveFlag)
+		log.Fatal(http.ListenAndServe(*serveFlag, newServer(*cacheSizeFlag, opts...)))
+	}
+
+	if *diffAgainstFlag != "" {
+		diff, err := generateDiff(*diffAgainstFlag, modelPathFlag, *modelIDFlag, *outputPathFlag, *alsoStdoutFlag, opts...)
+		if err != nil {
+			log.Fatalf("failed to generate graph: %v", err)
+		}
+
+		printDiff(diff)
+		return
+	}
 
-	bytes, err := os.ReadFile(*modelPathFlag)
+	if *dumpModelFlag {
+		if err := dumpModel(modelPathFlag, *modelIDFlag, *outputPathFlag, *alsoStdoutFlag); err != nil {
+			log.Fatalf("failed to dump model: %v", err)
+		}
+		return
+	}
+
+	if *sideBySideFlag != "" {
+		if err := generateSideBySide(*sideBySideFlag, modelPathFlag, *modelIDFlag, *outputPathFlag, *alsoStdoutFlag, opts...); err != nil {
+			log.Fatalf("failed to generate graph: %v", err)
+		}
+		return
+	}
+
+	if *validateFlag {
+		cycleInfo, err := validate(modelPathFlag, *modelIDFlag, opts...)
+		if err != nil {
+			log.Fatalf("invalid model: %v", err)
+		}
+
+		printWarnings(cycleInfo)
+		if *numberCyclesFlag {
+			printCycles(cycleInfo)
+		}
+		printSummary(cycleInfo)
+		if *failOnCyclesFlag {
+			if err := checkCycles(cycleInfo); err != nil {
+				log.Fatalf("error: %v", err)
+			}
+		}
+		return
+	}
+
+	if *expandFlag != "" {
+		if err := generateExpansion(modelPathFlag, *modelIDFlag, *outputPathFlag, *alsoStdoutFlag, *expandFlag, opts...); err != nil {
+			log.Fatalf("failed to generate graph: %v", err)
+		}
+		return
+	}
+
+	if *splitByTypeFlag {
+		if err := generateByType(modelPathFlag, *modelIDFlag, *outputPathFlag, opts...); err != nil {
+			log.Fatalf("failed to generate graphs: %v", err)
+		}
+		return
+	}
+
+	if *watchFlag {
+		if len(modelPathFlag) != 1 || isModelURL(modelPathFlag[0]) {
+			log.Fatalf("-watch requires -model-path to be a single local file or directory")
+		}
+		watch(modelPathFlag[0], time.Second, func() {
+			cycleInfo, err := generate(modelPathFlag, *modelIDFlag, *outputPathFlag, *alsoStdoutFlag, opts...)
+			if err != nil {
+				log.Printf("failed to generate graph: %v", err)
+				return
+			}
+
+			printWarnings(cycleInfo)
+			if *numberCyclesFlag {
+				printCycles(cycleInfo)
+			}
+			printSummary(cycleInfo)
+			if *failOnCyclesFlag {
+				if err := checkCycles(cycleInfo); err != nil {
+					log.Printf("error: %v", err)
+				}
+			}
+		})
+	}
+
+	cycleInfo, err := generate(modelPathFlag, *modelIDFlag, *outputPathFlag, *alsoStdoutFlag, opts...)
 	if err != nil {
-		log.Fatalf("failed to read model file: %v", err)
+		log.Fatalf("failed to generate graph: %v", err)
+	}
+
+	printWarnings(cycleInfo)
+	if *numberCyclesFlag {
+		printCycles(cycleInfo)
+	}
+	printSummary(cycleInfo)
+	if *failOnCyclesFlag {
+		if err := checkCycles(cycleInfo); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+}
+
+// listFlag is a flag that may be repeated or given a comma-separated list of
+// values.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
+		}
+	}
+	return nil
+}
+
+// repeatedFlag is a flag that may be repeated. Unlike listFlag, its values
+// are not split on commas, so they may contain commas.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func printDiff(diff *GraphDiff) {
+	for _, node := range diff.addedNodes {
+		log.Printf("added node: %s", node)
+	}
+	for _, node := range diff.removedNodes {
+		log.Printf("removed node: %s", node)
 	}
+	for _, edge := range diff.addedEdges {
+		log.Printf("added edge: %s", edge)
+	}
+	for _, edge := range diff.removedEdges {
+		log.Printf("removed edge: %s", edge)
+	}
+}
 
-	result, _ := Writer(string(bytes))
+// printSummary logs the size of the graph and its cycle counts. Like every
+// other message it goes to stderr, so that the graph can be piped from stdout.
+func printSummary(cycleInfo *CycleInformation) {
+	metrics := cycleInfo.metrics
+	log.Printf("generated graph: %d types, %d nodes, %d edges, %d definitive cycles, %d possible cycles",
+		metrics.types, metrics.nodes, metrics.edges, cycleInfo.definitiveCycles, cycleInfo.possibleCycles)
+}
 
-	var writer io.Writer
-	if *outputPathFlag != "" && *outputPathFlag != "-" {
-		writer, _ = os.Create(*outputPathFlag)
-	} else {
-		writer = os.Stdout
+// checkCycles returns an error listing the definitive cycles of the model,
+// after warning about its possible cycles, which OpenFGA accepts.
+func checkCycles(cycleInfo *CycleInformation) error {
+	if cycleInfo.possibleCycles > 0 {
+		log.Printf("warning: model has %d possible cycle(s)", cycleInfo.possibleCycles)
 	}
 
-	_, err = writer.Write([]byte(result))
+	return definitiveCyclesError(cycleInfo)
+}
+
+// printWarnings logs the warnings found while building the graph to stderr,
+// followed by its notices, if enabled.
+func printWarnings(cycleInfo *CycleInformation) {
+	for _, warning := range cycleInfo.warnings {
+		log.Printf("warning: %s", warning)
+	}
+	for _, notice := range cycleInfo.notices {
+		log.Printf("notice: %s", notice)
+	}
+}
+
+// printCycles logs the cycles of the model to stderr, numbered like the
+// colored cycles of the graph.
+func printCycles(cycleInfo *CycleInformation) {
+	for _, line := range cycleReport(cycleInfo) {
+		log.Print(line)
+	}
+}
+
+// generate reads the models at modelPaths and writes their graph to
+// outputPath, or to stdout if outputPath is empty or "-".
+func generate(modelPaths []string, modelID string, outputPath string, alsoStdout bool, opts ...Option) (*CycleInformation, error) {
+	model, moduleNames, err := loadModels(modelPaths, modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := newOutput(outputPath, alsoStdout)
+	cycleInfo, err := WriteModelTo(output, model, append(opts, WithModuleNames(moduleNames))...)
+	if closeErr := output.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to render graph: %w", closeErr)
+	}
 	if err != nil {
-		log.Fatalf("failed to render graph: %v", err)
+		return nil, err
 	}
+
+	return cycleInfo, nil
+}
+
+// validate reads the models at modelPaths and returns the information found
+// about their cycles, without rendering their graph, see Cycles.
+func validate(modelPaths []string, modelID string, opts ...Option) (*CycleInformation, error) {
+	model, _, err := loadModels(modelPaths, modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	return CyclesFromModel(model, opts...), nil
+}
+
+// dumpModel reads the models at modelPaths and writes the AuthorizationModel
+// their graph would be built from as indented protojson to outputPath, or to
+// stdout if outputPath is empty or "-", see output.
+func dumpModel(modelPaths []string, modelID, outputPath string, alsoStdout bool) error {
+	model, _, err := loadModels(modelPaths, modelID)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(model)
+	if err != nil {
+		return fmt.Errorf("failed to marshal model: %w", err)
+	}
+
+	return writeOutput(outputPath, alsoStdout, string(bytes)+"\n")
+}
+
+// generateDiff reads the model at oldModelPath and the models at modelPaths
+// and writes the graph of their differences to outputPath, or to stdout if
+// outputPath is empty or "-", see output.
+func generateDiff(oldModelPath string, modelPaths []string, modelID string, outputPath string, alsoStdout bool, opts ...Option) (*GraphDiff, error) {
+	oldModel, _, err := loadModel(oldModelPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("old model: %w", err)
+	}
+
+	model, _, err := loadModels(modelPaths, modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, diff, err := DiffModels(oldModel, model, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeOutput(outputPath, alsoStdout, result); err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+// generateSideBySide reads the model at oldModelPath and the models at
+// modelPaths and writes both of their graphs, next to each other, to
+// outputPath, or to stdout if outputPath is empty or "-", see output.
+func generateSideBySide(oldModelPath string, modelPaths []string, modelID, outputPath string, alsoStdout bool, opts ...Option) error {
+	oldModel, _, err := loadModel(oldModelPath, "")
+	if err != nil {
+		return fmt.Errorf("old model: %w", err)
+	}
+
+	model, _, err := loadModels(modelPaths, modelID)
+	if err != nil {
+		return err
+	}
+
+	result, err := SideBySideModels(oldModel, model, opts...)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(outputPath, alsoStdout, result)
+}
+
+// generateExpansion reads the models at modelPaths and writes the expansion
+// tree of relation to outputPath, or to stdout if outputPath is empty or "-",
+// see output.
+func generateExpansion(modelPaths []string, modelID string, outputPath string, alsoStdout bool, relation string, opts ...Option) error {
+	model, _, err := loadModels(modelPaths, modelID)
+	if err != nil {
+		return err
+	}
+
+	result, err := ExpansionTree(model, relation, opts...)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(outputPath, alsoStdout, result)
+}
+
+// generateByType reads the models at modelPaths and writes the graph of every
+// type to a file named after it, e.g. document.dot, in the directory outputDir.
+func generateByType(modelPaths []string, modelID string, outputDir string, opts ...Option) error {
+	info, err := os.Stat(outputDir)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("-split-by-type requires -output-path to be an existing directory, got %q", outputDir)
+	}
+
+	model, moduleNames, err := loadModels(modelPaths, modelID)
+	if err != nil {
+		return err
+	}
+
+	graphs, err := WritersByType(model, append(opts, WithModuleNames(moduleNames))...)
+	if err != nil {
+		return err
+	}
+
+	for typeName, result := range graphs {
+		if err := writeOutput(filepath.Join(outputDir, typeName+".dot"), false, result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// output writes to the file at path, or to stdout if path is empty or "-".
+// The file is only created by the first write, so that the previous graph is
+// kept if generating the new one fails before anything is written.
+type output struct {
+	path string
+	file *os.File
+	// alsoStdout writes to stdout as well as to the file. A target that fails
+	// doesn't stop writing to the other one; Close reports which failed.
+	alsoStdout bool
+	fileErr    error
+	stdoutErr  error
+}
+
+func newOutput(path string, alsoStdout bool) *output {
+	return &output{path: path, alsoStdout: alsoStdout}
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if o.path == "" || o.path == "-" {
+		return os.Stdout.Write(p)
+	}
+	if !o.alsoStdout {
+		return o.writeFile(p)
+	}
+
+	if o.fileErr == nil {
+		if _, err := o.writeFile(p); err != nil {
+			o.fileErr = fmt.Errorf("failed to write %s: %w", o.path, err)
+		}
+	}
+	if o.stdoutErr == nil {
+		if _, err := os.Stdout.Write(p); err != nil {
+			o.stdoutErr = fmt.Errorf("failed to write to stdout: %w", err)
+		}
+	}
+	if o.fileErr != nil && o.stdoutErr != nil {
+		return 0, errors.Join(o.fileErr, o.stdoutErr)
+	}
+	return len(p), nil
+}
+
+func (o *output) writeFile(p []byte) (int, error) {
+	if o.file == nil {
+		file, err := os.Create(o.path)
+		if err != nil {
+			return 0, err
+		}
+		o.file = file
+	}
+	return o.file.Write(p)
+}
+
+// Close closes the file written to, if any, and reports the targets that
+// failed while writing to both.
+func (o *output) Close() error {
+	var closeErr error
+	if o.file != nil {
+		closeErr = o.file.Close()
+	}
+	return errors.Join(o.fileErr, o.stdoutErr, closeErr)
+}
+
+// writeOutput writes result to outputPath, see output.
+func writeOutput(outputPath string, alsoStdout bool, result string) error {
+	output := newOutput(outputPath, alsoStdout)
+	_, err := output.Write([]byte(result))
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to render graph: %w", err)
+	}
+
+	return nil
+}
+
+// loadModels reads the models at modelPaths, see loadModel, selecting the
+// model with modelID from store exports, and combines them into a single
+// model if there are several (see mergeModels).
+func loadModels(modelPaths []string, modelID string) (*openfgav1.AuthorizationModel, map[string]string, error) {
+	if len(modelPaths) == 0 {
+		return nil, nil, fmt.Errorf("no model path given")
+	}
+	if len(modelPaths) == 1 {
+		return loadModel(modelPaths[0], modelID)
+	}
+
+	models := make([]*openfgav1.AuthorizationModel, 0, len(modelPaths))
+	moduleNames := map[string]string{}
+	for _, modelPath := range modelPaths {
+		model, names, err := loadModel(modelPath, modelID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", modelPath, err)
+		}
+		models = append(models, model)
+		for label, name := range names {
+			moduleNames[label] = name
+		}
+	}
+
+	model, err := mergeModels(modelPaths, models)
+	return model, moduleNames, err
+}
+
+// loadModel reads the model at modelPath, which is either a DSL file, a
+// directory or fga.mod manifest of a modular model, a store export, from
+// which the model with modelID is read (see parseStoreExport), or an http(s)
+// URL of a DSL file. For modular models, the names of the modules defining
+// the types and relations are returned too.
+func loadModel(modelPath, modelID string) (*openfgav1.AuthorizationModel, map[string]string, error) {
+	if isModelURL(modelPath) {
+		dsl, err := fetchModel(modelPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		model, err := parseModel(dsl)
+		return model, nil, err
+	}
+
+	if isModularModelPath(modelPath) {
+		return loadModularModel(modelPath)
+	}
+
+	if isStoreExportPath(modelPath) {
+		model, err := loadStoreExport(modelPath, modelID)
+		return model, nil, err
+	}
+
+	bytes, err := os.ReadFile(modelPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read model file: %w", err)
+	}
+
+	model, err := parseModel(string(bytes))
+	return model, nil, err
 }
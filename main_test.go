@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// runMainEnv is set in the environment of the test binary when it is run by
+// runMain, to run main instead of the tests.
+const runMainEnv = "OPENFGA_GRAPHVIZ_GEN_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs main with args in a process of its own, since it exits on
+// errors, and returns what it wrote to stdout and stderr and its exit status.
+func runMain(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	}
+	require.NoError(t, err)
+	return stdout.String(), stderr.String(), 0
+}
+
+// writeModelFile writes model to a file of a temporary directory and returns
+// its path.
+func writeModelFile(t *testing.T, model string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "model.fga")
+	require.NoError(t, os.WriteFile(path, []byte(model), 0o600))
+	return path
+}
+
+// setStdout replaces os.Stdout with file for the duration of the test.
+func setStdout(t *testing.T, file *os.File) {
+	t.Helper()
+
+	stdout := os.Stdout
+	os.Stdout = file
+	t.Cleanup(func() { os.Stdout = stdout })
+}
+
+const definitiveCycleModel = `
+	model
+		schema 1.1
+	type resource
+		relations
+			define a: b
+			define b: a`
+
+const possibleCycleModel = `
+	model
+		schema 1.1
+	type user
+	type document
+		relations
+			define viewer: [user, document#viewer] or editor
+			define editor: [user, document#viewer]`
+
+func TestOutput_FailingFile(t *testing.T) {
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	require.NoError(t, err)
+	defer stdout.Close()
+	setStdout(t, stdout)
+
+	path := filepath.Join(t.TempDir(), "missing", "graph.dot")
+	err = writeOutput(path, true, "digraph {}\n")
+	require.ErrorContains(t, err, "failed to write "+path)
+	require.NotContains(t, err.Error(), "stdout")
+
+	// the graph still made it to stdout
+	written, err := os.ReadFile(stdout.Name())
+	require.NoError(t, err)
+	require.Equal(t, "digraph {}\n", string(written))
+}
+
+func TestOutput_FailingStdout(t *testing.T) {
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	require.NoError(t, err)
+	require.NoError(t, stdout.Close())
+	setStdout(t, stdout)
+
+	path := filepath.Join(t.TempDir(), "graph.dot")
+	err = writeOutput(path, true, "digraph {}\n")
+	require.ErrorContains(t, err, "failed to write to stdout")
+	require.NotContains(t, err.Error(), path)
+
+	// the graph still made it to the file
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "digraph {}\n", string(written))
+}
+
+func TestMain_FailOnCycles(t *testing.T) {
+	stdout, stderr, status := runMain(t, "-fail-on-cycles", "-model-path", writeModelFile(t, definitiveCycleModel))
+	require.Equal(t, 1, status)
+	require.Contains(t, stdout, "digraph")
+	require.Contains(t, stderr, "error: model has 1 definitive cycle(s): resource#a -> resource#b -> resource#a")
+
+	// possible cycles only warn
+	_, stderr, status = runMain(t, "-fail-on-cycles", "-model-path", writeModelFile(t, possibleCycleModel))
+	require.Zero(t, status)
+	require.Contains(t, stderr, "warning: model has 1 possible cycle(s)")
+
+	// without the flag, definitive cycles don't fail either
+	_, _, status = runMain(t, "-model-path", writeModelFile(t, definitiveCycleModel))
+	require.Zero(t, status)
+}
+
+func TestMain_Validate(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "graph.dot")
+	stdout, stderr, status := runMain(t, "-validate", "-model-path", writeModelFile(t, possibleCycleModel), "-output-path", outputPath)
+	require.Zero(t, status)
+	require.Empty(t, stdout)
+	require.Contains(t, stderr, "generated graph: 2 types, 3 nodes")
+	require.NoFileExists(t, outputPath)
+
+	_, stderr, status = runMain(t, "-validate", "-fail-on-cycles", "-model-path", writeModelFile(t, definitiveCycleModel))
+	require.Equal(t, 1, status)
+	require.Contains(t, stderr, "error: model has 1 definitive cycle(s)")
+
+	_, stderr, status = runMain(t, "-validate", "-model-path", writeModelFile(t, "model\n  schema 1.1\ntype"))
+	require.Equal(t, 1, status)
+	require.Contains(t, stderr, "invalid model: ")
+}
+
+func TestDumpModel(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "model.json")
+	require.NoError(t, dumpModel([]string{writeModelFile(t, possibleCycleModel)}, "", outputPath, false))
+
+	dumped, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+
+	var model openfgav1.AuthorizationModel
+	require.NoError(t, protojson.Unmarshal(dumped, &model))
+	require.Equal(t, "1.1", model.GetSchemaVersion())
+	require.Len(t, model.GetTypeDefinitions(), 2)
+	require.Equal(t, "user", model.GetTypeDefinitions()[0].GetType())
+	require.Equal(t, "document", model.GetTypeDefinitions()[1].GetType())
+	require.Contains(t, model.GetTypeDefinitions()[1].GetRelations(), "viewer")
+
+	// the model is dumped instead of the graph
+	stdout, _, status := runMain(t, "-dump-model", "-model-path", writeModelFile(t, possibleCycleModel))
+	require.Zero(t, status)
+	require.JSONEq(t, string(dumped), stdout)
+}
+
+func TestMain_Quiet(t *testing.T) {
+	stdout, stderr, status := runMain(t, "-quiet", "-fail-on-cycles", "-model-path", writeModelFile(t, definitiveCycleModel))
+	require.Equal(t, 1, status)
+	require.Contains(t, stdout, "digraph")
+	require.Empty(t, stderr)
+
+	_, stderr, status = runMain(t, "-quiet", "-model-path", filepath.Join(t.TempDir(), "missing.fga"))
+	require.Equal(t, 1, status)
+	require.Empty(t, stderr)
+}
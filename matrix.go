@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// Reachability returns the labels of the relation nodes of the graph, sorted,
+// and the transitive closure of its edges between them: reachable[i][j]
+// reports whether relation j can be reached from relation i through one or
+// more edges, i.e. whether i contributes to granting j. The subtracted
+// operands of exclusions revoke rather than grant, so their edges aren't
+// followed. Operands of intersections contribute without granting on their
+// own, and a relation only reaches itself through a cycle. Operator nodes are
+// followed, but aren't part of the matrix.
+func (g *dotEncodingGraph) Reachability() ([]string, [][]bool) {
+	var labels []string
+	for _, n := range g.SortedNodes() {
+		if label := g.reverseMapping[n.ID()]; n.operatorOf == "" && strings.Contains(label, "#") {
+			labels = append(labels, label)
+		}
+	}
+
+	index := make(map[int64]int, len(labels))
+	for i, label := range labels {
+		index[g.mapping[label]] = i
+	}
+
+	reachable := make([][]bool, len(labels))
+	for i, label := range labels {
+		reachable[i] = make([]bool, len(labels))
+
+		seen := map[int64]bool{}
+		pending := []int64{g.mapping[label]}
+		for len(pending) > 0 {
+			id := pending[0]
+			pending = pending[1:]
+			to := g.From(id)
+			for to.Next() {
+				next := to.Node().ID()
+				if seen[next] || !grants(g, id, next) {
+					continue
+				}
+				seen[next] = true
+				if j, ok := index[next]; ok {
+					reachable[i][j] = true
+				}
+				pending = append(pending, next)
+			}
+		}
+	}
+
+	return labels, reachable
+}
+
+// grants reports whether any of the edges from the node from to the node to
+// grants it, rather than being the subtracted operand of an exclusion.
+func grants(g *dotEncodingGraph, from, to int64) bool {
+	lines := g.Lines(from, to)
+	for lines.Next() {
+		if !lines.Line().(*dotLine).subtracted {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteMatrix writes the reachability matrix of the relations of the graph to
+// out as CSV, see Reachability. The first row and the first column hold the
+// labels of the relations, and every other cell is 1 if the relation of its
+// column can be reached from the relation of its row, or 0 otherwise.
+func (g *dotEncodingGraph) WriteMatrix(out io.Writer) error {
+	labels, reachable := g.Reachability()
+
+	w := csv.NewWriter(out)
+	if err := w.Write(append([]string{""}, labels...)); err != nil {
+		return err
+	}
+	for i, label := range labels {
+		row := []string{label}
+		for _, r := range reachable[i] {
+			if r {
+				row = append(row, "1")
+			} else {
+				row = append(row, "0")
+			}
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
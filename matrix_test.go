@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReachability(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type document
+			relations
+				define blocked: [user]
+				define owner: [user, group#member]
+				define editor: [user] or owner
+				define viewer: editor but not blocked`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions(WithOperatorNodes()))
+	g.RemoveNodesWithNoEdges()
+
+	labels, reachable := g.Reachability()
+	require.Equal(t, []string{"document#blocked", "document#editor", "document#owner", "document#viewer", "group#member"}, labels)
+	// owner implies editor and, through it, viewer; the subtracted blocked
+	// grants nothing, and group#member reaches itself through group#member
+	// assignments
+	require.Equal(t, [][]bool{
+		{false, false, false, false, false},
+		{false, false, false, true, false},
+		{false, true, false, true, false},
+		{false, false, false, false, false},
+		{false, true, true, true, true},
+	}, reachable)
+}
+
+func TestWriter_Matrix(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define owner: [user]
+				define viewer: [user] or owner`
+
+	actual, _, err := Writer(model, WithOutputFormat(formatMatrix))
+	require.NoError(t, err)
+	require.Equal(t, `,document#owner,document#viewer
+document#owner,0,1
+document#viewer,0,0
+`, actual)
+}
+
+func TestWriter_MatrixDisplayOptions(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent`
+
+	expected, _, err := Writer(model, WithOutputFormat(formatMatrix))
+	require.NoError(t, err)
+	require.Equal(t, `,document#parent,document#viewer,folder#viewer
+document#parent,0,0,0
+document#viewer,0,0,0
+folder#viewer,0,1,0
+`, expected)
+
+	// the matrix follows what every relation grants, however the edges are
+	// drawn
+	for name, opt := range map[string]Option{
+		"reverse":        WithReverse(),
+		"tupleset_hops":  WithTuplesetHops(),
+		"operator_nodes": WithOperatorNodes(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			actual, _, err := Writer(model, WithOutputFormat(formatMatrix), opt)
+			require.NoError(t, err)
+			require.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestWriter_MatrixNestedExclusions(t *testing.T) {
+	tests := map[string]struct {
+		rewrite  string
+		expected string
+	}{
+		// b and d are only subtracted, through the union they are part of
+		`subtracted_union`: {
+			rewrite: "a but not (b or d)",
+			expected: `,document#a,document#b,document#c,document#d
+document#a,0,0,1,0
+document#b,0,0,0,0
+document#c,0,0,0,0
+document#d,0,0,0,0
+`,
+		},
+		// a is subtracted from b, but grants c through the union anyway
+		`subtracted_and_granting`: {
+			rewrite: "(b but not a) or a",
+			expected: `,document#a,document#b,document#c,document#d
+document#a,0,0,1,0
+document#b,0,0,1,0
+document#c,0,0,0,0
+document#d,0,0,0,0
+`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			model := `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define a: [user]
+						define b: [user]
+						define d: [user]
+						define c: ` + test.rewrite
+
+			for _, opts := range [][]Option{nil, {WithOperatorNodes()}} {
+				actual, _, err := Writer(model, append(opts, WithOutputFormat(formatMatrix))...)
+				require.NoError(t, err)
+				require.Equal(t, test.expected, actual)
+			}
+		})
+	}
+}
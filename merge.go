@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// mergeModels combines separately authored models, named by the paths they
+// were read from, into a single model. A type or condition defined by several
+// models is only kept once if every definition is identical; definitions that
+// differ are an error, as are models of different schema versions.
+func mergeModels(paths []string, models []*openfgav1.AuthorizationModel) (*openfgav1.AuthorizationModel, error) {
+	merged := &openfgav1.AuthorizationModel{
+		SchemaVersion: models[0].GetSchemaVersion(),
+		Conditions:    map[string]*openfgav1.Condition{},
+	}
+	typedefs := map[string]*openfgav1.TypeDefinition{}
+	typeSources := map[string]int{}
+	conditionSources := map[string]int{}
+
+	for i, model := range models {
+		if model.GetSchemaVersion() != merged.GetSchemaVersion() {
+			return nil, fmt.Errorf("%s: schema %s differs from schema %s of %s", paths[i], model.GetSchemaVersion(), merged.GetSchemaVersion(), paths[0])
+		}
+
+		for _, typedef := range model.GetTypeDefinitions() {
+			existing, ok := typedefs[typedef.GetType()]
+			if !ok {
+				typedefs[typedef.GetType()] = typedef
+				typeSources[typedef.GetType()] = i
+				merged.TypeDefinitions = append(merged.TypeDefinitions, typedef)
+				continue
+			}
+
+			if !proto.Equal(existing, typedef) {
+				return nil, fmt.Errorf("%s: type %s conflicts with its definition in %s", paths[i], typedef.GetType(), paths[typeSources[typedef.GetType()]])
+			}
+		}
+
+		for conditionName, condition := range model.GetConditions() {
+			source, ok := conditionSources[conditionName]
+			if !ok {
+				conditionSources[conditionName] = i
+				merged.Conditions[conditionName] = condition
+				continue
+			}
+
+			if !proto.Equal(merged.Conditions[conditionName], condition) {
+				return nil, fmt.Errorf("%s: condition %s conflicts with its definition in %s", paths[i], conditionName, paths[source])
+			}
+		}
+	}
+
+	return merged, nil
+}
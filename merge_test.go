@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mergeTestDocuments = `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`
+
+	mergeTestFolders = `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user, user with in_office]
+
+		condition in_office(ip: ipaddress) {
+			ip.in_cidr("10.0.0.0/8")
+		}`
+)
+
+func parseModels(t *testing.T, dsls ...string) []*openfgav1.AuthorizationModel {
+	t.Helper()
+
+	models := make([]*openfgav1.AuthorizationModel, 0, len(dsls))
+	for _, dsl := range dsls {
+		model, err := parseModel(dsl)
+		require.NoError(t, err)
+		models = append(models, model)
+	}
+	return models
+}
+
+func TestMergeModels(t *testing.T) {
+	merged, err := mergeModels([]string{"documents.fga", "folders.fga"}, parseModels(t, mergeTestDocuments, mergeTestFolders))
+	require.NoError(t, err)
+
+	// the user type is shared, and only kept once
+	var types []string
+	for _, typedef := range merged.GetTypeDefinitions() {
+		types = append(types, typedef.GetType())
+	}
+	require.Equal(t, []string{"user", "document", "folder"}, types)
+	require.Contains(t, merged.GetConditions(), "in_office")
+
+	actualDOT, _, err := WriterFromModel(merged)
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, `[label="document#viewer"]`)
+	require.Contains(t, actualDOT, `[label="folder#viewer"]`)
+	require.Contains(t, actualDOT, `[label="user[with in_office]"]`)
+}
+
+func TestMergeModels_Conflicts(t *testing.T) {
+	testCases := map[string]struct {
+		dsl           string
+		expectedError string
+	}{
+		`type`: {
+			dsl: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define viewer: [user]
+						define editor: [user]`,
+			expectedError: "other.fga: type document conflicts with its definition in documents.fga",
+		},
+		`condition`: {
+			dsl: `
+				model
+					schema 1.1
+				type user
+				type team
+					relations
+						define member: [user with in_office]
+
+				condition in_office(ip: ipaddress) {
+					ip.in_cidr("192.168.0.0/16")
+				}`,
+			expectedError: "other.fga: condition in_office conflicts with its definition in folders.fga",
+		},
+	}
+
+	for name, testCase := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := mergeModels(
+				[]string{"documents.fga", "folders.fga", "other.fga"},
+				parseModels(t, mergeTestDocuments, mergeTestFolders, testCase.dsl),
+			)
+			require.EqualError(t, err, testCase.expectedError)
+		})
+	}
+}
+
+func TestMergeModels_SchemaVersions(t *testing.T) {
+	models := parseModels(t, mergeTestDocuments, mergeTestFolders)
+	models[1].SchemaVersion = "1.0"
+
+	_, err := mergeModels([]string{"documents.fga", "folders.fga"}, models)
+	require.EqualError(t, err, "folders.fga: schema 1.0 differs from schema 1.1 of documents.fga")
+}
+
+func TestLoadModels(t *testing.T) {
+	dir := t.TempDir()
+	documents := filepath.Join(dir, "documents.fga")
+	folders := filepath.Join(dir, "folders.fga")
+	require.NoError(t, os.WriteFile(documents, []byte(mergeTestDocuments), 0o644))
+	require.NoError(t, os.WriteFile(folders, []byte(mergeTestFolders), 0o644))
+
+	model, _, err := loadModels([]string{documents, folders}, "")
+	require.NoError(t, err)
+	require.Len(t, model.GetTypeDefinitions(), 3)
+
+	single, _, err := loadModels([]string{documents}, "")
+	require.NoError(t, err)
+	require.Len(t, single.GetTypeDefinitions(), 2)
+
+	_, _, err = loadModels([]string{documents, filepath.Join(dir, "missing.fga")}, "")
+	require.ErrorContains(t, err, "missing.fga: failed to read model file")
+}
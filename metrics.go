@@ -0,0 +1,75 @@
+package main
+
+import (
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// GraphMetrics describes the size and shape of the graph of a model. Tracked
+// over time, it gives a sense of how the complexity of a model evolves.
+type GraphMetrics struct {
+	nodes     int
+	edges     int
+	types     int
+	relations int
+	// the number of edges in the longest directed path. Nodes that are part
+	// of the same cycle are treated as a single node so the length is finite.
+	maxDepth int
+}
+
+func computeMetrics(model *openfgav1.AuthorizationModel, g *dotEncodingGraph) GraphMetrics {
+	metrics := GraphMetrics{
+		nodes:    g.Nodes().Len(),
+		edges:    len(g.SortedLines()),
+		types:    len(model.GetTypeDefinitions()),
+		maxDepth: longestPath(g),
+	}
+	for _, typedef := range model.GetTypeDefinitions() {
+		metrics.relations += len(typedef.GetRelations())
+	}
+
+	return metrics
+}
+
+// longestPath returns the number of edges in the longest directed path of the
+// condensation of g, i.e. the graph in which every strongly connected
+// component of g is collapsed into a single node.
+func longestPath(g *dotEncodingGraph) int {
+	components := topo.TarjanSCC(g)
+	componentOf := make(map[int64]int, g.Nodes().Len())
+	for i, component := range components {
+		for _, n := range component {
+			componentOf[n.ID()] = i
+		}
+	}
+
+	depths := make([]int, len(components))
+	visited := make([]bool, len(components))
+
+	var depth func(c int) int
+	depth = func(c int) int {
+		if visited[c] {
+			return depths[c]
+		}
+		visited[c] = true
+
+		for _, n := range components[c] {
+			to := g.From(n.ID())
+			for to.Next() {
+				next := componentOf[to.Node().ID()]
+				if next != c {
+					depths[c] = max(depths[c], depth(next)+1)
+				}
+			}
+		}
+
+		return depths[c]
+	}
+
+	longest := 0
+	for c := range components {
+		longest = max(longest, depth(c))
+	}
+
+	return longest
+}
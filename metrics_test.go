@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_Metrics(t *testing.T) {
+	testCases := map[string]struct {
+		model           string
+		expectedMetrics GraphMetrics
+	}{
+		`with_union`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+				  relations
+					define member: [user, group#member]
+				type folder
+				  relations
+					define viewer: [user]
+				type document
+				  relations
+					define parent: [folder]
+					define editor: [user]
+					define viewer: [user, user:*, group#member] or editor or viewer from parent`,
+			// user -> document#editor -> document#viewer
+			expectedMetrics: GraphMetrics{nodes: 8, edges: 10, types: 4, relations: 5, maxDepth: 2},
+		},
+		`cycle_counts_as_one_node`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type resource
+					relations
+						define a: [user] or b
+						define b: [user] or a
+						define c: a`,
+			// user -> {resource#a, resource#b} -> resource#c
+			expectedMetrics: GraphMetrics{nodes: 4, edges: 5, types: 2, relations: 3, maxDepth: 2},
+		},
+		`multigraph`: {
+			model: `
+				model
+				  schema 1.1
+				type user
+				type state
+				  relations
+					define can_view: [user]
+				type transition
+				  relations
+					define start: [state]
+					define end: [state]
+					define can_apply: [user] and can_view from start and can_view from end`,
+			// user -> state#can_view -> transition#can_apply
+			expectedMetrics: GraphMetrics{nodes: 6, edges: 6, types: 3, relations: 4, maxDepth: 2},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, cycleInfo, err := Writer(test.model)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedMetrics, cycleInfo.metrics)
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/typesystem"
+	"gopkg.in/yaml.v3"
+)
+
+// moduleManifestName is the name of the manifest listing the files of a
+// modular model.
+const moduleManifestName = "fga.mod"
+
+// moduleModelHeader is prepended to every module file so that it can be
+// parsed as a standalone model.
+const moduleModelHeader = "model\n  schema 1.1\n"
+
+type moduleManifest struct {
+	Schema   string   `yaml:"schema"`
+	Contents []string `yaml:"contents"`
+}
+
+// isModularModelPath reports whether path refers to a modular model, which is
+// either a directory of module files or an fga.mod manifest.
+func isModularModelPath(path string) bool {
+	if filepath.Base(path) == moduleManifestName {
+		return true
+	}
+
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// loadModularModel reads the module files referenced by path and combines them
+// into a single AuthorizationModel, along with the names of the modules that
+// define its types and relations (see combineModules). If path is an fga.mod
+// manifest, or a directory containing one, the files listed in the manifest
+// are used. Otherwise every .fga file found under the directory is used.
+func loadModularModel(path string) (*openfgav1.AuthorizationModel, map[string]string, error) {
+	files, _, err := moduleFiles(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	modules := make(map[string]string, len(files))
+	for _, file := range files {
+		bytes, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read module file: %w", err)
+		}
+		modules[file] = string(bytes)
+	}
+
+	return combineModules(modules)
+}
+
+// moduleFiles returns the module files referenced by path, see
+// loadModularModel, along with the path of the manifest listing them, or ""
+// if the files were found by walking the directory.
+func moduleFiles(path string) (files []string, manifestPath string, err error) {
+	manifestPath = path
+	if filepath.Base(path) != moduleManifestName {
+		manifestPath = filepath.Join(path, moduleManifestName)
+	}
+
+	if _, err := os.Stat(manifestPath); err == nil {
+		bytes, err := os.ReadFile(manifestPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read module manifest: %w", err)
+		}
+
+		var manifest moduleManifest
+		if err := yaml.Unmarshal(bytes, &manifest); err != nil {
+			return nil, "", fmt.Errorf("failed to parse module manifest: %w", err)
+		}
+
+		for _, file := range manifest.Contents {
+			files = append(files, filepath.Join(filepath.Dir(manifestPath), file))
+		}
+	} else {
+		manifestPath = ""
+		err := filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(file) == ".fga" {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list module files: %w", err)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("no module files found in %s", path)
+	}
+
+	return files, manifestPath, nil
+}
+
+// combineModules parses every module file (keyed by file name) and merges
+// their type definitions and conditions into a single model. Types extended by
+// several modules have their relations merged; a relation or condition that
+// is defined more than once is an error. The model carries no module
+// information, so the name of the module that defines every type and relation
+// is returned alongside it, keyed by node label, e.g. "organization" or
+// "organization#member".
+func combineModules(modules map[string]string) (*openfgav1.AuthorizationModel, map[string]string, error) {
+	fileNames := make([]string, 0, len(modules))
+	for name := range modules {
+		fileNames = append(fileNames, name)
+	}
+	sort.Strings(fileNames)
+
+	combined := &openfgav1.AuthorizationModel{
+		SchemaVersion: typesystem.SchemaVersion1_1,
+		Conditions:    map[string]*openfgav1.Condition{},
+	}
+	typedefs := map[string]*openfgav1.TypeDefinition{}
+	moduleNames := map[string]string{}
+
+	for _, name := range fileNames {
+		moduleName, model, err := parseModuleFile(name, modules[name])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, typedef := range model.GetTypeDefinitions() {
+			for relation := range typedef.GetRelations() {
+				moduleNames[nodeLabel(typedef.GetType(), relation, false, "")] = moduleName
+			}
+
+			existing, ok := typedefs[typedef.GetType()]
+			if !ok {
+				typedefs[typedef.GetType()] = typedef
+				combined.TypeDefinitions = append(combined.TypeDefinitions, typedef)
+				moduleNames[nodeLabel(typedef.GetType(), "", false, "")] = moduleName
+				continue
+			}
+
+			if existing.Relations == nil {
+				existing.Relations = map[string]*openfgav1.Userset{}
+			}
+			if existing.GetMetadata().GetRelations() == nil {
+				existing.Metadata = &openfgav1.Metadata{Relations: map[string]*openfgav1.RelationMetadata{}}
+			}
+
+			for relation, rewrite := range typedef.GetRelations() {
+				if _, ok := existing.Relations[relation]; ok {
+					return nil, nil, fmt.Errorf("%s: relation %s#%s is already defined by another module", name, typedef.GetType(), relation)
+				}
+				existing.Relations[relation] = rewrite
+				existing.Metadata.Relations[relation] = typedef.GetMetadata().GetRelations()[relation]
+			}
+		}
+
+		for conditionName, condition := range model.GetConditions() {
+			if _, ok := combined.Conditions[conditionName]; ok {
+				return nil, nil, fmt.Errorf("%s: condition %s is already defined by another module", name, conditionName)
+			}
+			combined.Conditions[conditionName] = condition
+		}
+	}
+
+	return combined, moduleNames, nil
+}
+
+// parseModuleFile parses a single module file, returning the name of the
+// module along with its model. The module declaration is replaced by a model
+// header and "extend type" declarations are parsed as regular type
+// definitions, to be merged by combineModules.
+func parseModuleFile(name, contents string) (string, *openfgav1.AuthorizationModel, error) {
+	lines := strings.Split(contents, "\n")
+	moduleName := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "module "):
+			lines[i] = ""
+			moduleName = strings.TrimSpace(strings.TrimPrefix(trimmed, "module "))
+		case strings.HasPrefix(trimmed, "extend type "):
+			lines[i] = strings.Replace(line, "extend type ", "type ", 1)
+		}
+	}
+
+	if moduleName == "" {
+		return "", nil, fmt.Errorf("%s: missing module declaration", name)
+	}
+
+	model, err := parseModel(moduleModelHeader + strings.Join(lines, "\n"))
+	if err != nil {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			parseErr.file = name
+			parseErr.lineOffset = strings.Count(moduleModelHeader, "\n")
+		}
+		return "", nil, err
+	}
+
+	return moduleName, model, nil
+}
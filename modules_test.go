@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadModularModel(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		moduleManifestName: `schema: '1.2'
+contents:
+  - core.fga
+  - issues/projects.fga
+`,
+		"core.fga": `module core
+
+type user
+
+type organization
+  relations
+    define member: [user]
+    define admin: [user]
+`,
+		"issues/projects.fga": `module issue-tracker
+
+extend type organization
+  relations
+    define can_create_project: admin
+
+type project
+  relations
+    define organization: [organization]
+    define viewer: member from organization
+`,
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	}
+
+	for _, path := range []string{dir, filepath.Join(dir, moduleManifestName)} {
+		require.True(t, isModularModelPath(path))
+
+		model, moduleNames, err := loadModularModel(path)
+		require.NoError(t, err)
+		require.Len(t, model.GetTypeDefinitions(), 3)
+		assert.Equal(t, map[string]string{
+			"user":                            "core",
+			"organization":                    "core",
+			"organization#member":             "core",
+			"organization#admin":              "core",
+			"organization#can_create_project": "issue-tracker",
+			"project":                         "issue-tracker",
+			"project#organization":            "issue-tracker",
+			"project#viewer":                  "issue-tracker",
+		}, moduleNames)
+
+		actualDOT, _, err := WriterFromModel(model, WithModuleNames(moduleNames))
+		require.NoError(t, err)
+		assert.Contains(t, actualDOT, `"organization#can_create_project"`)
+		assert.Contains(t, actualDOT, `"project#viewer"`)
+		assert.Contains(t, actualDOT, `tooltip="module issue-tracker"`)
+
+		// The nodes of types and relations are annotated with their module.
+		g, _ := buildGraph(model, newOptions(WithModuleNames(moduleNames)))
+		for label, moduleName := range map[string]string{"organization": "core", "organization#can_create_project": "issue-tracker"} {
+			n := g.Node(g.mapping[label]).(*dotNode)
+			assert.Equal(t, "module "+moduleName, n.attrs["tooltip"])
+		}
+	}
+}
+
+func TestCombineModules_Errors(t *testing.T) {
+	testCases := map[string]struct {
+		modules       map[string]string
+		expectedError string
+	}{
+		`duplicate_relation`: {
+			modules: map[string]string{
+				"a.fga": "module a\ntype user\ntype document\n  relations\n    define viewer: [user]\n",
+				"b.fga": "module b\nextend type document\n  relations\n    define viewer: [user]\n",
+			},
+			expectedError: "b.fga: relation document#viewer is already defined by another module",
+		},
+		`missing_module_declaration`: {
+			modules: map[string]string{
+				"a.fga": "type user\n",
+			},
+			expectedError: "a.fga: missing module declaration",
+		},
+		`syntax_error_reports_file_line`: {
+			modules: map[string]string{
+				"a.fga": "module a\ntype user\ntype document\n  relations\n    define viewer [user]\n",
+			},
+			expectedError: "a.fga: parse error: syntax error at line=5",
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := combineModules(test.modules)
+			require.ErrorContains(t, err, test.expectedError)
+		})
+	}
+}
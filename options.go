@@ -0,0 +1,432 @@
+package main
+
+const (
+	// formatDOT renders the graph as plain DOT.
+	formatDOT = "dot"
+	// formatDOTClusterByRewrite renders the graph as DOT with operator nodes,
+	// grouping every relation and its operator nodes in a cluster.
+	formatDOTClusterByRewrite = "dot-cluster-by-rewrite"
+	// formatGraphML renders the graph as GraphML, for tools like yEd or Gephi.
+	formatGraphML = "graphml"
+	// formatCSV renders the edges of the graph as CSV, a row per edge, for
+	// reviewing the model in a spreadsheet.
+	formatCSV = "csv"
+	// formatMatrix renders the reachability matrix of the relations as CSV,
+	// for analyzing which relations contribute to which.
+	formatMatrix = "matrix"
+)
+
+// Option configures how Writer renders a model.
+type Option func(*options)
+
+type options struct {
+	cyclesOnly         bool
+	collapseConditions bool
+	tooltips           bool
+	relations          []string
+	operatorNodes      bool
+	format             string
+	title              bool
+	reverse            bool
+	header             bool
+	headerTimestamp    bool
+	fontname           string
+	hiddenUserTypes    []string
+	onlyUserTypes      []string
+	maxNodes           int
+	maxEdges           int
+	inlineAssignable   bool
+	graphAttrs         []string
+	typeSummary        bool
+	legend             bool
+	types              []string
+	htmlLabels         bool
+	weights            bool
+	dpi                float64
+	size               string
+	moduleNames        map[string]string
+	tuplesetHops       bool
+	noConditions       bool
+	summaryCounts      bool
+	sortedEdges        bool
+	recordNodes        bool
+	wildcardLabel      string
+	highlight          string
+	closureSizes       bool
+	theme              string
+	typeShapes         bool
+	labelIDs           bool
+	typeRanks          []string
+	numberedCycles     bool
+	tuplesetLabel      string
+	selfUsersetNotices bool
+	keepIsolated       bool
+	conditionParams    bool
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{format: formatDOT}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCyclesOnly renders only the nodes and edges that take part in a cycle.
+func WithCyclesOnly() Option {
+	return func(o *options) {
+		o.cyclesOnly = true
+	}
+}
+
+// WithCollapsedConditions draws a single node for a type that is assignable
+// with different conditions, and labels each edge with its condition instead.
+func WithCollapsedConditions() Option {
+	return func(o *options) {
+		o.collapseConditions = true
+	}
+}
+
+// WithTooltips adds a tooltip to every edge describing the rewrite it was
+// drawn for, e.g. "computed userset: editor".
+func WithTooltips() Option {
+	return func(o *options) {
+		o.tooltips = true
+	}
+}
+
+// WithRelations renders only the given relations, referenced as
+// type#relation, along with their immediate neighbors. Passing several
+// relations renders the union of their neighborhoods.
+func WithRelations(relations ...string) Option {
+	return func(o *options) {
+		o.relations = append(o.relations, relations...)
+	}
+}
+
+// WithOperatorNodes draws every intersection and exclusion as an operator
+// node that its operands feed into, like unions and nested operators always
+// are. Without it, the operands of the outermost intersection or exclusion of
+// a rewrite feed its relation directly.
+func WithOperatorNodes() Option {
+	return func(o *options) {
+		o.operatorNodes = true
+	}
+}
+
+// WithOutputFormat selects the output format, "dot" by default.
+// "dot-cluster-by-rewrite" draws operator nodes and groups every relation with
+// its operator nodes in a cluster, ranking operators by their nesting depth.
+// "graphml" writes the graph as GraphML, with the attributes of its nodes and
+// edges as data.
+func WithOutputFormat(format string) Option {
+	return func(o *options) {
+		o.format = format
+	}
+}
+
+// WithTitle labels the graph with the schema version of the model and, if it
+// has one, the model ID.
+func WithTitle() Option {
+	return func(o *options) {
+		o.title = true
+	}
+}
+
+// WithReverse flips the direction of every edge, so that edges point from a
+// relation to the relations and types it grants access to.
+func WithReverse() Option {
+	return func(o *options) {
+		o.reverse = true
+	}
+}
+
+// WithHeader prepends comments to the output recording that it was generated
+// by this tool and the hash of the model it was generated from, so that
+// checked-in graphs can be traced back to their model. If timestamp is true,
+// the time the graph was generated at is recorded too, at the cost of the
+// output no longer being reproducible.
+func WithHeader(timestamp bool) Option {
+	return func(o *options) {
+		o.header = true
+		o.headerTimestamp = timestamp
+	}
+}
+
+// WithFontname sets the font of the graph, its nodes and its edges, so that
+// the graph renders the same on every machine.
+func WithFontname(fontname string) Option {
+	return func(o *options) {
+		o.fontname = fontname
+	}
+}
+
+// WithHiddenUserTypes drops the edges drawn from concrete users of the given
+// types, e.g. "user", to focus on the relationships between objects.
+func WithHiddenUserTypes(types ...string) Option {
+	return func(o *options) {
+		o.hiddenUserTypes = append(o.hiddenUserTypes, types...)
+	}
+}
+
+// WithOnlyUserTypes keeps only the edges drawn from concrete users of the
+// given types, along with the edges drawn from relations.
+func WithOnlyUserTypes(types ...string) Option {
+	return func(o *options) {
+		o.onlyUserTypes = append(o.onlyUserTypes, types...)
+	}
+}
+
+// WithMaxNodes truncates the graph to at most n nodes, keeping the edges in
+// the order they were drawn until the limit is reached.
+func WithMaxNodes(n int) Option {
+	return func(o *options) {
+		o.maxNodes = n
+	}
+}
+
+// WithMaxEdges truncates the graph to at most n edges, keeping the edges in
+// the order they were drawn.
+func WithMaxEdges(n int) Option {
+	return func(o *options) {
+		o.maxEdges = n
+	}
+}
+
+// WithInlineAssignable lists the directly related user types of every
+// relation in the label of its node, e.g. "document#viewer\n[user, group#member]".
+func WithInlineAssignable() Option {
+	return func(o *options) {
+		o.inlineAssignable = true
+	}
+}
+
+// WithGraphAttributes adds graphviz graph attributes given as key=value, e.g.
+// "bgcolor=white", overriding the defaults such as rankdir=BT.
+func WithGraphAttributes(attrs ...string) Option {
+	return func(o *options) {
+		o.graphAttrs = append(o.graphAttrs, attrs...)
+	}
+}
+
+// WithTypeSummary collapses the relations of every type into a single node
+// for the type, drawing the dependencies between types instead.
+func WithTypeSummary() Option {
+	return func(o *options) {
+		o.typeSummary = true
+	}
+}
+
+// WithLegend adds a legend explaining the styles of the edges and the
+// operator nodes.
+func WithLegend() Option {
+	return func(o *options) {
+		o.legend = true
+	}
+}
+
+// WithTypes renders only the relations of the given types, along with their
+// immediate neighbors.
+func WithTypes(types ...string) Option {
+	return func(o *options) {
+		o.types = append(o.types, types...)
+	}
+}
+
+// WithHTMLLabels renders the labels of relation nodes as graphviz HTML-like
+// labels with their type prefix in bold, e.g. "<b>document#</b>viewer". Not
+// every renderer supports HTML-like labels, so they are opt-in.
+func WithHTMLLabels() Option {
+	return func(o *options) {
+		o.htmlLabels = true
+	}
+}
+
+// WithWeights adds the weight of every edge, an approximation of the cost of
+// evaluating it in ListObjects queries, as its fga_weight attribute.
+func WithWeights() Option {
+	return func(o *options) {
+		o.weights = true
+	}
+}
+
+// WithDPI sets the resolution of images rendered from the graph, in dots per
+// inch.
+func WithDPI(dpi float64) Option {
+	return func(o *options) {
+		o.dpi = dpi
+	}
+}
+
+// WithSize sets the maximum size of images rendered from the graph, as
+// width[,height] in inches, e.g. "7.5,10". A trailing "!" scales smaller
+// graphs up to the size too.
+func WithSize(size string) Option {
+	return func(o *options) {
+		o.size = size
+	}
+}
+
+// WithModuleNames adds the name of the module that defines a type or relation
+// to the tooltip of its node, given the module names keyed by node label as
+// returned for modular models.
+func WithModuleNames(moduleNames map[string]string) Option {
+	return func(o *options) {
+		o.moduleNames = moduleNames
+	}
+}
+
+// WithTuplesetHops draws every tuple to userset as two hops through the node
+// of its tupleset relation, e.g. folder#viewer -> document#parent ->
+// document#viewer, instead of a single edge labeled with the tupleset.
+func WithTuplesetHops() Option {
+	return func(o *options) {
+		o.tuplesetHops = true
+	}
+}
+
+// WithoutConditions leaves conditions out of the graph entirely, merging the
+// conditioned and unconditioned assignments of a type into a single node and
+// edge, for a purely structural view of the model.
+func WithoutConditions() Option {
+	return func(o *options) {
+		o.noConditions = true
+	}
+}
+
+// WithSummaryCounts labels every edge of the type summary with the number of
+// relation-level edges it aggregates, e.g. "[3]", to quantify the coupling
+// between types. It only has an effect together with WithTypeSummary.
+func WithSummaryCounts() Option {
+	return func(o *options) {
+		o.summaryCounts = true
+	}
+}
+
+// WithSortedEdges writes the node and edge definitions sorted by label, the
+// edges by the label of their source, then of their target, then by their
+// number, so that the output diffs well between versions of a model.
+func WithSortedEdges() Option {
+	return func(o *options) {
+		o.sortedEdges = true
+	}
+}
+
+// WithRecordNodes draws every type as a single record node with a field per
+// relation, wiring the edges to the fields, for a denser, UML-like rendering.
+func WithRecordNodes() Option {
+	return func(o *options) {
+		o.recordNodes = true
+	}
+}
+
+// WithWildcardLabel displays wildcard nodes as the given template instead of
+// as "user:*", with {type} replaced by the type, e.g. "{type} (public)".
+func WithWildcardLabel(template string) Option {
+	return func(o *options) {
+		o.wildcardLabel = template
+	}
+}
+
+// WithHighlight emphasizes the given type#relation and everything it is
+// derived from, i.e. every node and edge from which it can be reached, and
+// grays out the rest of the graph.
+func WithHighlight(relation string) Option {
+	return func(o *options) {
+		o.highlight = relation
+	}
+}
+
+// WithClosureSizes adds to the label of every relation the number of concrete
+// user types that can ultimately be granted it, following direct assignments,
+// computed usersets and tuple to usersets back to the users, e.g.
+// "document#viewer\n(2 user types)". Record nodes don't show it.
+func WithClosureSizes() Option {
+	return func(o *options) {
+		o.closureSizes = true
+	}
+}
+
+// WithTheme colors the background, nodes and edges of the graph with a preset,
+// "light" or "dark", e.g. for embedding it in dark documentation sites.
+// Without a theme the graph uses the graphviz defaults.
+func WithTheme(name string) Option {
+	return func(o *options) {
+		o.theme = name
+	}
+}
+
+// WithTypeShapes draws type nodes, including wildcards, as boxes and relation
+// nodes as ellipses, so that they can be told apart in grayscale or printed
+// diagrams. Operator and record nodes keep their shapes.
+func WithTypeShapes() Option {
+	return func(o *options) {
+		o.typeShapes = true
+	}
+}
+
+// WithLabelIDs identifies the nodes in the DOT output by IDs derived from
+// their labels, e.g. document_viewer, instead of by numbers that shift when
+// the model changes, so that the output is stable and self-describing.
+func WithLabelIDs() Option {
+	return func(o *options) {
+		o.labelIDs = true
+	}
+}
+
+// WithTypeRanks pins the nodes of types to graphviz ranks, given as
+// type=rank, e.g. "user=source" or "document=sink". See rankKeywords for the
+// supported ranks.
+func WithTypeRanks(ranks ...string) Option {
+	return func(o *options) {
+		o.typeRanks = append(o.typeRanks, ranks...)
+	}
+}
+
+// WithNumberedCycles numbers the cycles of the model in the order they are
+// reported and, combined with WithHighlight, colors every highlighted cycle
+// distinctly, adding a legend mapping the colors to the cycle numbers.
+func WithNumberedCycles() Option {
+	return func(o *options) {
+		o.numberedCycles = true
+	}
+}
+
+// WithTuplesetLabel displays the head labels of tuple to userset edges as the
+// given template instead of as "(viewer from document#parent)", with
+// {relation}, {type} and {tupleset} replaced by the relation, the type of the
+// tupleset and the tupleset relation, e.g. "from {tupleset}".
+func WithTuplesetLabel(template string) Option {
+	return func(o *options) {
+		o.tuplesetLabel = template
+	}
+}
+
+// WithSelfUsersetNotices reports the relations that are assignable to their
+// own userset, e.g. "define viewer: [document#viewer]", as notices. Such
+// recursion is often intended, so it isn't reported by default, and it is
+// never counted as a cycle.
+func WithSelfUsersetNotices() Option {
+	return func(o *options) {
+		o.selfUsersetNotices = true
+	}
+}
+
+// WithKeepIsolated keeps the types and relations that have no edges in the
+// graph, e.g. types without relations that nothing references, as standalone
+// nodes, for a complete inventory of the model. They are still reported as
+// isolated.
+func WithKeepIsolated() Option {
+	return func(o *options) {
+		o.keepIsolated = true
+	}
+}
+
+// WithConditionParams adds the parameters of their condition to the labels of
+// conditioned nodes, e.g. "user[with condition1(x: int)]", so that reviewers
+// can tell what the condition evaluates.
+func WithConditionParams() Option {
+	return func(o *options) {
+		o.conditionParams = true
+	}
+}
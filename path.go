@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/openfga/openfga/pkg/typesystem"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/path"
+	"gonum.org/v1/gonum/graph/traverse"
+)
+
+// PathBetween returns the labels of the nodes on a shortest path from the
+// node labeled from to the node labeled to, e.g. from "user" to
+// "document#viewer", answering how the users or relations of from are granted
+// to. Operator nodes are skipped, so that the path goes from relation to
+// relation. Like in RelationsReachableFrom, the subtracted operands of
+// exclusions aren't followed. If there are several shortest paths, the first
+// one by labels is returned, and if to can't be reached from from, the path
+// is empty.
+func PathBetween(modelString string, from, to string) ([]string, error) {
+	model, err := parseModel(modelString)
+	if err != nil {
+		return nil, err
+	}
+
+	g, _ := buildGraph(model, newOptions())
+	g.RemoveNodesWithNoEdges()
+	g = g.RelationGraph()
+	// the subtracted operand of an exclusion denies rather than grants
+	for _, l := range g.SortedLines() {
+		if l.subtracted {
+			g.RemoveLine(l.From().ID(), l.To().ID(), l.ID())
+		}
+	}
+
+	for _, label := range []string{from, to} {
+		if _, ok := g.mapping[label]; !ok {
+			return nil, fmt.Errorf("node %s not found in the model", label)
+		}
+	}
+
+	paths, _ := path.DijkstraAllFrom(g.Node(g.mapping[from]), g).AllTo(g.mapping[to])
+
+	var shortest []string
+	for _, p := range paths {
+		labels := make([]string, 0, len(p))
+		for _, n := range p {
+			labels = append(labels, g.reverseMapping[n.ID()])
+		}
+		if shortest == nil || slices.Compare(labels, shortest) < 0 {
+			shortest = labels
+		}
+	}
+
+	return shortest, nil
+}
+
+// RelationsReachableFrom returns the labels of the relations reachable from
+// the users of userType, sorted, e.g. "document#viewer" for "user", answering
+// what a user of the type can be granted. Besides the node of the type itself,
+// the walk starts from its wildcard and its conditioned nodes, e.g. "user:*"
+// and "user[with condition1]", since these are granted to the users of the
+// type too. The subtracted operands of exclusions are not followed, as the
+// relation is denied rather than granted through them.
+func RelationsReachableFrom(modelString string, userType string) ([]string, error) {
+	model, err := parseModel(modelString)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := typesystem.New(model).GetTypeDefinition(userType); !ok {
+		return nil, fmt.Errorf("type %s not found in the model", userType)
+	}
+
+	g, _ := buildGraph(model, newOptions())
+	g.RemoveNodesWithNoEdges()
+	g = g.RelationGraph()
+
+	var reachable []string
+	walker := traverse.BreadthFirst{
+		// the subtracted operand of an exclusion denies rather than grants
+		Traverse: func(e graph.Edge) bool {
+			return grants(g, e.From().ID(), e.To().ID())
+		},
+		Visit: func(n graph.Node) {
+			if label := g.reverseMapping[n.ID()]; strings.Contains(label, "#") {
+				reachable = append(reachable, label)
+			}
+		},
+	}
+	for _, n := range g.SortedNodes() {
+		if label := g.reverseMapping[n.ID()]; typeOf(label) == userType && !strings.Contains(label, "#") {
+			walker.Walk(g, n, nil)
+		}
+	}
+
+	sort.Strings(reachable)
+	return reachable, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const pathTestModel = `
+	model
+		schema 1.1
+	type user
+	type group
+		relations
+			define member: [user, group#member]
+	type folder
+		relations
+			define viewer: [user]
+	type document
+		relations
+			define parent: [folder]
+			define editor: [user]
+			define viewer: [user, user:*, group#member] or editor or viewer from parent
+	type report
+		relations
+			define document: [document]
+			define reader: viewer from document`
+
+func TestPathBetween(t *testing.T) {
+	testCases := map[string]struct {
+		from, to     string
+		expectedPath []string
+	}{
+		`direct`: {
+			from:         "user",
+			to:           "document#viewer",
+			expectedPath: []string{"user", "document#viewer"},
+		},
+		`through_tupleset`: {
+			from:         "folder#viewer",
+			to:           "document#viewer",
+			expectedPath: []string{"folder#viewer", "document#viewer"},
+		},
+		`through_userset`: {
+			from:         "group#member",
+			to:           "document#viewer",
+			expectedPath: []string{"group#member", "document#viewer"},
+		},
+		`several_hops`: {
+			from:         "user",
+			to:           "report#reader",
+			expectedPath: []string{"user", "document#viewer", "report#reader"},
+		},
+		`computed`: {
+			from:         "document#editor",
+			to:           "document#viewer",
+			expectedPath: []string{"document#editor", "document#viewer"},
+		},
+		`unreachable`: {
+			from:         "document#viewer",
+			to:           "document#editor",
+			expectedPath: nil,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actualPath, err := PathBetween(pathTestModel, test.from, test.to)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedPath, actualPath)
+		})
+	}
+}
+
+const nestedExclusionModel = `
+	model
+		schema 1.1
+	type user
+	type group
+		relations
+			define member: [user]
+	type document
+		relations
+			define a: [group]
+			define b: [user]
+			define d: [user]
+			define c: a but not (b or d)`
+
+func TestPathBetween_Exclusion(t *testing.T) {
+	path, err := PathBetween(nestedExclusionModel, "group", "document#c")
+	require.NoError(t, err)
+	require.Equal(t, []string{"group", "document#a", "document#c"}, path)
+
+	// b is only subtracted from c
+	path, err = PathBetween(nestedExclusionModel, "document#b", "document#c")
+	require.NoError(t, err)
+	require.Empty(t, path)
+}
+
+func TestPathBetween_UnknownNode(t *testing.T) {
+	_, err := PathBetween(pathTestModel, "user", "document#owner")
+	require.EqualError(t, err, "node document#owner not found in the model")
+}
+
+func TestRelationsReachableFrom(t *testing.T) {
+	testCases := map[string]struct {
+		model             string
+		userType          string
+		expectedRelations []string
+	}{
+		`several_hops`: {
+			model:    pathTestModel,
+			userType: "user",
+			expectedRelations: []string{
+				"document#editor", "document#viewer", "folder#viewer", "group#member", "report#reader",
+			},
+		},
+		`object_type`: {
+			model:             pathTestModel,
+			userType:          "folder",
+			expectedRelations: []string{"document#parent"},
+		},
+		`unreachable`: {
+			model:             pathTestModel,
+			userType:          "report",
+			expectedRelations: nil,
+		},
+		`ttu_example`: { // examples/ttu.fga
+			model: `
+				model
+					schema 1.1
+				type user
+				type group
+					relations
+						define viewer: [user]
+				type folder
+					relations
+						define writer: [user]
+						define parent: [folder, group]
+						define viewer: writer from parent`,
+			userType:          "user",
+			expectedRelations: []string{"folder#viewer", "folder#writer", "group#viewer"},
+		},
+		`wildcard_example`: { // examples/wildcard.fga
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define writer: [user:*]
+						define viewer: [user] or writer`,
+			userType:          "user",
+			expectedRelations: []string{"document#viewer", "document#writer"},
+		},
+		`conditioned`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type document
+					relations
+						define viewer: [user with condition1]
+
+				condition condition1(x: int) {
+					x < 100
+				}`,
+			userType:          "user",
+			expectedRelations: []string{"document#viewer"},
+		},
+		`exclusion_subtracted`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type bot
+				type document
+					relations
+						define blocked: [bot]
+						define viewer: [user]
+						define can_view: viewer but not blocked`,
+			userType: "bot",
+			// bots are only ever subtracted from can_view
+			expectedRelations: []string{"document#blocked"},
+		},
+		`exclusion_base`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type bot
+				type document
+					relations
+						define blocked: [bot]
+						define viewer: [user]
+						define can_view: viewer but not blocked`,
+			userType:          "user",
+			expectedRelations: []string{"document#can_view", "document#viewer"},
+		},
+		`exclusion_nested_subtracted`: {
+			model:    nestedExclusionModel,
+			userType: "user",
+			// b and d are only subtracted from c, through their union
+			expectedRelations: []string{"document#b", "document#d", "group#member"},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actualRelations, err := RelationsReachableFrom(test.model, test.userType)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedRelations, actualRelations)
+		})
+	}
+}
+
+func TestRelationsReachableFrom_UnknownType(t *testing.T) {
+	_, err := RelationsReachableFrom(pathTestModel, "team")
+	require.EqualError(t, err, "type team not found in the model")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// recordEscaper escapes the characters that have a meaning in the label of a
+// graphviz record node.
+var recordEscaper = strings.NewReplacer(`{`, `\{`, `}`, `\}`, `|`, `\|`, `<`, `\<`, `>`, `\>`, `"`, `\"`)
+
+// RecordNodes returns a copy of the graph in which the type node and the
+// relation nodes of every type are drawn as a single record node, with the
+// type in its first field followed by a field per relation, e.g.
+// "{document|<editor> editor|<viewer> viewer}". Edges from and to a relation
+// are wired to the port of its field, and edges from and to the users of the
+// type to the whole record. Wildcards and operator nodes stay nodes of their
+// own.
+func (g *dotEncodingGraph) RecordNodes() *dotEncodingGraph {
+	records := newDotEncodingGraph()
+	records.clusterRewrites = g.clusterRewrites
+	records.title = g.title
+
+	// endpoint returns the label of the node an edge from or to n is drawn
+	// from or to in the copy, and the port of the node it is wired to
+	endpoint := func(n *dotNode) (label, port string) {
+		label = g.reverseMapping[n.ID()]
+		if n.operatorOf != "" {
+			return label, ""
+		}
+		if record, relation, ok := strings.Cut(label, "#"); ok {
+			return record, relation
+		}
+		return label, ""
+	}
+
+	fields := map[string][]string{}
+	for _, n := range g.SortedNodes() {
+		label, port := endpoint(n)
+		if port == "" {
+			records.copyNode(label, n)
+			continue
+		}
+
+		records.AddOrGetNode(label)
+		fields[label] = append(fields[label], port)
+	}
+
+	for record, relations := range fields {
+		n := records.Node(records.mapping[record]).(*dotNode)
+		labels := make([]string, 0, len(relations)+1)
+		labels = append(labels, recordEscaper.Replace(record))
+		for _, relation := range relations {
+			labels = append(labels, fmt.Sprintf("<%s> %s", relation, recordEscaper.Replace(relation)))
+		}
+		n.attrs["label"] = fmt.Sprintf(`"{%s}"`, strings.Join(labels, "|"))
+		n.attrs["shape"] = "record"
+	}
+
+	for _, l := range g.SortedLines() {
+		from, fromPort := endpoint(l.From().(*dotNode))
+		to, toPort := endpoint(l.To().(*dotNode))
+		if copied := records.AddPortEdge(from, fromPort, to, toPort, l.kind, l.attrs["headlabel"], l.condition); copied != nil {
+			copied.copyFrom(l)
+			copied.fromPort, copied.toPort = fromPort, toPort
+		}
+	}
+
+	return records
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriter_RecordNodes(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user, group#member]
+				define viewer: editor or viewer from parent`
+
+	actualDOT, _, err := Writer(model, WithRecordNodes())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [
+label="{document|<editor> editor|<parent> parent|<viewer> viewer}"
+shape=record
+];
+1 [
+label=or
+shape=diamond
+];
+2 [
+label="{folder|<viewer> viewer}"
+shape=record
+];
+3 [
+label="{group|<member> member}"
+shape=record
+];
+4 [label=user];
+5 [label="user:*"];
+
+// Edge definitions.
+0:editor -> 1 [
+label=5
+style=dashed
+];
+1 -> 0:viewer [label=4];
+2 -> 0:parent [label=3];
+2:viewer -> 1 [
+headlabel="(viewer from document#parent)"
+label=6
+];
+3:member -> 0:editor [label=2];
+3:member -> 3:member [
+color=blue
+label=10
+];
+4 -> 0:editor [label=1];
+4 -> 2:viewer [label=7];
+4 -> 3:member [label=8];
+5 -> 3:member [label=9];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+}
+
+func TestRecordNodes_Ports(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user with condition1]
+		type document
+			relations
+				define editor: [user, group#member with condition1]
+				define owner: [user]
+				define viewer: editor but not owner
+
+		condition condition1(x: int) {
+			x < 100
+		}`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions())
+	g.RemoveNodesWithNoEdges()
+	records := g.RecordNodes()
+
+	type wiredEdge struct {
+		from, fromPort, to, toPort string
+		color                      string
+	}
+	var edges []wiredEdge
+	for _, l := range records.SortedLines() {
+		edges = append(edges, wiredEdge{
+			from:     records.reverseMapping[l.From().ID()],
+			fromPort: l.fromPort,
+			to:       records.reverseMapping[l.To().ID()],
+			toPort:   l.toPort,
+			color:    l.attrs["color"],
+		})
+	}
+
+	// the edges from document#editor and document#owner both connect the
+	// document record to itself, but are wired to different ports, so neither
+	// is a duplicate or a self reference
+	require.ElementsMatch(t, []wiredEdge{
+		{from: "user", to: "document", toPort: "editor"},
+		{from: "group[with condition1]", fromPort: "member", to: "document", toPort: "editor"},
+		{from: "user[with condition1]", to: "group", toPort: "member"},
+		{from: "user", to: "document", toPort: "owner"},
+		{from: "document", fromPort: "editor", to: "document", toPort: "viewer"},
+		{from: "document", fromPort: "owner", to: "document", toPort: "viewer"},
+	}, edges)
+
+	n := records.Node(records.mapping["group[with condition1]"]).(*dotNode)
+	require.Equal(t, `"{group[with condition1]|<member> member}"`, n.attrs["label"])
+	require.Equal(t, "record", n.attrs["shape"])
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+)
+
+// maxModelSize is the largest model the server accepts, in bytes.
+const maxModelSize = 1 << 20
+
+// dotContentType is the media type of DOT graphs.
+const dotContentType = "text/vnd.graphviz"
+
+// contentTypes are the media types of the graphs served, by output format.
+var contentTypes = map[string]string{
+	formatDOT:                 dotContentType,
+	formatDOTClusterByRewrite: dotContentType,
+	formatGraphML:             "application/graphml+xml",
+	formatCSV:                 "text/csv",
+	formatMatrix:              "text/csv",
+}
+
+// newServer returns a handler that renders the graph of the model DSL posted
+// to /graph. The graph is returned in the output format of opts, with its
+// media type, or, for DOT, as SVG if the request accepts image/svg+xml, in
+// which case graphviz must be installed. The graphs of up to cacheSize models
+// are cached.
+func newServer(cacheSize int, opts ...Option) http.Handler {
+	writer := NewCachedWriter(cacheSize, opts...)
+	contentType := contentTypes[newOptions(opts...).format]
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graph", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxModelSize))
+		if err != nil {
+			status := http.StatusBadRequest
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, fmt.Sprintf("failed to read model: %v", err), status)
+			return
+		}
+
+		result, _, err := writer.Write(string(body))
+		if err != nil {
+			status := http.StatusInternalServerError
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		if contentType == dotContentType && strings.Contains(r.Header.Get("Accept"), "image/svg+xml") {
+			svg, err := renderSVG(result)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "image/svg+xml")
+			_, _ = w.Write(svg)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		_, _ = io.WriteString(w, result)
+	})
+
+	return mux
+}
+
+// renderSVG renders a DOT graph as SVG with the graphviz dot command.
+func renderSVG(graph string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("dot", "-Tsvg")
+	cmd.Stdin = strings.NewReader(graph)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to render SVG: %w: %s", err, stderr.String())
+	}
+
+	return stdout.Bytes(), nil
+}
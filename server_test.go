@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const serverTestModel = `
+	model
+		schema 1.1
+	type user
+	type document
+		relations
+			define viewer: [user]`
+
+func TestServer_DOT(t *testing.T) {
+	server := httptest.NewServer(newServer(defaultCacheSize))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/graph", "text/plain", strings.NewReader(serverTestModel))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/vnd.graphviz", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	expected, _, err := Writer(serverTestModel)
+	require.NoError(t, err)
+	require.Equal(t, getSorted(expected), getSorted(string(body)))
+}
+
+func TestServer_ParseError(t *testing.T) {
+	server := httptest.NewServer(newServer(defaultCacheSize))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/graph", "text/plain", strings.NewReader("model\n  schema 1.1\ntype"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "parse error")
+}
+
+func TestServer_MethodNotAllowed(t *testing.T) {
+	server := httptest.NewServer(newServer(defaultCacheSize))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/graph")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestServer_SVG(t *testing.T) {
+	if _, err := exec.LookPath("dot"); err != nil {
+		t.Skip("graphviz is not installed")
+	}
+
+	server := httptest.NewServer(newServer(defaultCacheSize))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/graph", strings.NewReader(serverTestModel))
+	require.NoError(t, err)
+	req.Header.Set("Accept", "image/svg+xml")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "image/svg+xml", resp.Header.Get("Content-Type"))
+}
+
+func TestServer_TooLarge(t *testing.T) {
+	server := httptest.NewServer(newServer(defaultCacheSize))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/graph", "text/plain", strings.NewReader(strings.Repeat(" ", maxModelSize+1)))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestServer_OutputFormats(t *testing.T) {
+	for format, contentType := range map[string]string{
+		formatDOTClusterByRewrite: "text/vnd.graphviz",
+		formatGraphML:             "application/graphml+xml",
+		formatCSV:                 "text/csv",
+		formatMatrix:              "text/csv",
+	} {
+		t.Run(format, func(t *testing.T) {
+			server := httptest.NewServer(newServer(defaultCacheSize, WithOutputFormat(format)))
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/graph", strings.NewReader(serverTestModel))
+			require.NoError(t, err)
+			if contentType != dotContentType {
+				// SVG is only rendered from DOT, other formats are returned
+				// as is
+				req.Header.Set("Accept", "image/svg+xml, */*")
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, contentType, resp.Header.Get("Content-Type"))
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			expected, _, err := Writer(serverTestModel, WithOutputFormat(format))
+			require.NoError(t, err)
+			require.Equal(t, getSorted(expected), getSorted(string(body)))
+		})
+	}
+}
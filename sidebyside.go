@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"gonum.org/v1/gonum/graph/encoding"
+	"gonum.org/v1/gonum/graph/encoding/dot"
+)
+
+// sideBySideVersions are the versions of a side by side graph, in the order
+// their clusters are written. The nodes of a version are identified by their
+// labels prefixed with the version, e.g. "old/document#viewer", and are still
+// labeled document#viewer.
+var sideBySideVersions = []string{"old", "new"}
+
+// SideBySideGraphs returns a graph containing the graphs of both models, each
+// in a cluster of its own, e.g. to compare the models of a migration. Unlike
+// DiffGraphs, both graphs are kept intact instead of being merged into one.
+func SideBySideGraphs(oldDSL, newDSL string, opts ...Option) (string, error) {
+	oldModel, err := parseModel(oldDSL)
+	if err != nil {
+		return "", fmt.Errorf("old model: %w", err)
+	}
+
+	newModel, err := parseModel(newDSL)
+	if err != nil {
+		return "", fmt.Errorf("new model: %w", err)
+	}
+
+	return SideBySideModels(oldModel, newModel, opts...)
+}
+
+// SideBySideModels is like SideBySideGraphs, for models that are already
+// parsed.
+func SideBySideModels(oldModel, newModel *openfgav1.AuthorizationModel, opts ...Option) (string, error) {
+	o := newOptions(opts...)
+
+	graphAttrs, err := graphAttributes(o)
+	if err != nil {
+		return "", err
+	}
+
+	combined := newDotEncodingGraph()
+	var titles []string
+	for i, model := range []*openfgav1.AuthorizationModel{oldModel, newModel} {
+		g, _ := analyzeModel(model, o)
+		combined.copyVersion(sideBySideVersions[i], g)
+		titles = append(titles, modelTitle(model))
+	}
+
+	if o.sortedEdges {
+		combined = combined.SortedByLabel()
+	}
+	combined.NumberEdges()
+	combined.fontname = o.fontname
+	combined.graphAttrs = graphAttrs
+	combined.theme = themes[o.theme]
+	combined.legend = o.legend
+	if o.labelIDs {
+		combined.UseLabelIDs()
+	}
+
+	multi, err := marshalDOT(&sideBySideGraph{dotEncodingGraph: combined, titles: titles})
+	if err != nil {
+		return "", fmt.Errorf("failed to render graph: %w", err)
+	}
+
+	return multi, nil
+}
+
+// copyVersion copies the nodes and edges of g, including the nodes without
+// edges kept by WithKeepIsolated, identifying its nodes by their labels
+// prefixed with the version, see sideBySideVersions.
+func (g *dotEncodingGraph) copyVersion(version string, from *dotEncodingGraph) {
+	prefix := version + "/"
+	copyNode := func(n *dotNode) string {
+		label := prefix + from.reverseMapping[n.ID()]
+		g.copyNode(label, n)
+		if n.operatorOf != "" {
+			g.Node(g.mapping[label]).(*dotNode).operatorOf = prefix + n.operatorOf
+		}
+		return label
+	}
+
+	for _, l := range from.SortedLines() {
+		fromLabel, toLabel := copyNode(l.From().(*dotNode)), copyNode(l.To().(*dotNode))
+		copied := g.AddEdge(fromLabel, toLabel, l.kind, l.attrs["headlabel"], l.condition)
+		if copied != nil {
+			copied.copyFrom(l)
+		}
+	}
+	for _, n := range from.SortedNodes() {
+		copyNode(n)
+	}
+}
+
+// sideBySideGraph is a graph combining the graphs of several versions of a
+// model, which are written as clusters labeled with the version and the
+// title of the model, e.g. "old: schema 1.1".
+type sideBySideGraph struct {
+	*dotEncodingGraph
+	// titles are the titles of the models, in the order of
+	// sideBySideVersions.
+	titles []string
+}
+
+// Structure returns a cluster for every version, containing its nodes,
+// followed by the structure of the combined graph, e.g. its legend.
+func (g *sideBySideGraph) Structure() []dot.Multigraph {
+	var structure []dot.Multigraph
+	for i, version := range sideBySideVersions {
+		cluster := newDotCluster("cluster_"+version, encoding.Attribute{Key: "label", Value: fmt.Sprintf("%s: %s", version, g.titles[i])})
+		for _, n := range g.SortedNodes() {
+			if strings.HasPrefix(g.reverseMapping[n.ID()], version+"/") {
+				cluster.AddNode(n)
+			}
+		}
+		structure = append(structure, cluster)
+	}
+	return append(structure, g.dotEncodingGraph.Structure()...)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSideBySideGraphs(t *testing.T) {
+	oldModel := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define owner: [user]
+				define viewer: [user] or owner`
+
+	newModel := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`
+
+	actualDOT, err := SideBySideGraphs(oldModel, newModel)
+	require.NoError(t, err)
+
+	// the nodes shared by both models are drawn once per model
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+subgraph cluster_old {
+graph [
+label="old: schema 1.1"
+];
+
+// Node definitions.
+0 [label=user];
+1 [label="document#owner"];
+2 [
+label=or
+shape=diamond
+];
+3 [label="document#viewer"];
+}
+subgraph cluster_new {
+graph [
+label="new: schema 1.1"
+];
+
+// Node definitions.
+4 [label=user];
+5 [label="document#viewer"];
+}
+// Node definitions.
+0 [label=user];
+1 [label="document#owner"];
+2 [
+label=or
+shape=diamond
+];
+3 [label="document#viewer"];
+4 [label=user];
+5 [label="document#viewer"];
+
+// Edge definitions.
+0 -> 1 [label=1];
+0 -> 2 [label=3];
+1 -> 2 [
+label=4
+style=dashed
+];
+2 -> 3 [label=2];
+4 -> 5 [label=5];
+}`
+	require.Equal(t, expectedDOT, actualDOT)
+
+	_, err = SideBySideGraphs(oldModel, "model")
+	require.ErrorContains(t, err, "new model: ")
+}
+
+func TestSideBySideGraphs_LabelIDs(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`
+
+	actualDOT, err := SideBySideGraphs(model, model, WithLabelIDs(), WithLegend())
+	require.NoError(t, err)
+
+	// the IDs of the nodes of both versions don't collide
+	require.Contains(t, actualDOT, "old_user -> old_document_viewer [label=1];")
+	require.Contains(t, actualDOT, "new_user -> new_document_viewer [label=2];")
+	require.Contains(t, actualDOT, "subgraph cluster_legend {")
+}
+
+func TestSideBySideGraphs_KeepIsolated(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]
+		type folder`
+
+	actualDOT, err := SideBySideGraphs(model, model)
+	require.NoError(t, err)
+	require.NotContains(t, actualDOT, `label=folder`)
+
+	// isolated types are kept in both versions, like in a single graph
+	actualDOT, err = SideBySideGraphs(model, model, WithKeepIsolated(), WithLabelIDs())
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, "old_folder [label=folder];")
+	require.Contains(t, actualDOT, "new_folder [label=folder];")
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// WritersByType renders a graph for every type of the model that defines
+// relations, containing only the relations of that type and their immediate
+// neighbors. The graphs are keyed by type name.
+func WritersByType(model *openfgav1.AuthorizationModel, opts ...Option) (map[string]string, error) {
+	var typeNames []string
+	for _, typeDef := range model.GetTypeDefinitions() {
+		if len(typeDef.GetRelations()) > 0 {
+			typeNames = append(typeNames, typeDef.GetType())
+		}
+	}
+
+	graphs := map[string]string{}
+	for _, typeName := range typeNames {
+		result, _, err := WriterFromModel(model, append(slices.Clone(opts), WithTypes(typeName))...)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", typeName, err)
+		}
+		graphs[typeName] = result
+	}
+
+	return graphs, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritersByType(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent`)
+	require.NoError(t, err)
+
+	graphs, err := WritersByType(model)
+	require.NoError(t, err)
+	require.Len(t, graphs, 2)
+	require.Contains(t, graphs, "document")
+	require.Contains(t, graphs, "folder")
+
+	// The graph of a type keeps the neighbors of its relations, but not the
+	// edges between other types.
+	require.Contains(t, graphs["document"], `label="folder#viewer"`)
+	require.Contains(t, graphs["folder"], `label="document#viewer"`)
+	require.NotContains(t, graphs["folder"], `label="document#parent"`)
+
+	expected, _, err := WriterFromModel(model, WithTypes("folder"))
+	require.NoError(t, err)
+	require.Equal(t, getSorted(expected), getSorted(graphs["folder"]))
+}
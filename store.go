@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// storeExportExtension is the extension of store exports, which are read as
+// JSON rather than as DSL.
+const storeExportExtension = ".json"
+
+// isStoreExportPath reports whether the model path refers to a store export,
+// i.e. the JSON of the authorization models of a store.
+func isStoreExportPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), storeExportExtension)
+}
+
+// loadStoreExport reads the store export at path and returns its model with
+// the given ID, see parseStoreExport.
+func loadStoreExport(path, modelID string) (*openfgav1.AuthorizationModel, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store export: %w", err)
+	}
+
+	return parseStoreExport(bytes, modelID)
+}
+
+// parseStoreExport returns the model with the given ID from a store export,
+// which is either a JSON array of authorization models or a response of the
+// ReadAuthorizationModels API, i.e. an object with an authorization_models
+// array. If modelID is empty, the export must contain a single model.
+func parseStoreExport(data []byte, modelID string) (*openfgav1.AuthorizationModel, error) {
+	var rawModels []json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var response struct {
+			AuthorizationModels []json.RawMessage `json:"authorization_models"`
+		}
+		if err := json.Unmarshal(data, &response); err != nil {
+			return nil, fmt.Errorf("failed to parse store export: %w", err)
+		}
+		rawModels = response.AuthorizationModels
+	} else if err := json.Unmarshal(data, &rawModels); err != nil {
+		return nil, fmt.Errorf("failed to parse store export: %w", err)
+	}
+
+	if len(rawModels) == 0 {
+		return nil, fmt.Errorf("store export contains no models")
+	}
+
+	models := make([]*openfgav1.AuthorizationModel, 0, len(rawModels))
+	ids := make([]string, 0, len(rawModels))
+	for i, raw := range rawModels {
+		model := &openfgav1.AuthorizationModel{}
+		if err := protojson.Unmarshal(raw, model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %d of store export: %w", i, err)
+		}
+		models = append(models, model)
+		ids = append(ids, model.GetId())
+	}
+
+	if modelID == "" {
+		if len(models) > 1 {
+			return nil, fmt.Errorf("store export contains %d models, pass -model-id to select one of: %s", len(models), strings.Join(ids, ", "))
+		}
+		return models[0], nil
+	}
+
+	for _, model := range models {
+		if model.GetId() == modelID {
+			return model, nil
+		}
+	}
+
+	return nil, fmt.Errorf("model %q not found in store export, which contains: %s", modelID, strings.Join(ids, ", "))
+}
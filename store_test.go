@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const storeTestExport = `[
+	{
+		"id": "01HVMMBCMGZNT3SED4Z17ECXCA",
+		"schema_version": "1.1",
+		"type_definitions": [
+			{"type": "user"},
+			{
+				"type": "document",
+				"relations": {"viewer": {"this": {}}},
+				"metadata": {"relations": {"viewer": {"directly_related_user_types": [{"type": "user"}]}}}
+			}
+		]
+	},
+	{
+		"id": "01HVMMBCMGZNT3SED4Z17ECXCB",
+		"schema_version": "1.1",
+		"type_definitions": [
+			{"type": "user"},
+			{
+				"type": "folder",
+				"relations": {"viewer": {"this": {}}},
+				"metadata": {"relations": {"viewer": {"directly_related_user_types": [{"type": "user"}]}}}
+			}
+		]
+	}
+]`
+
+func TestParseStoreExport(t *testing.T) {
+	model, err := parseStoreExport([]byte(storeTestExport), "01HVMMBCMGZNT3SED4Z17ECXCB")
+	require.NoError(t, err)
+	require.Equal(t, "01HVMMBCMGZNT3SED4Z17ECXCB", model.GetId())
+
+	actual, _, err := WriterFromModel(model)
+	require.NoError(t, err)
+	require.Contains(t, actual, `[label="folder#viewer"]`)
+	require.NotContains(t, actual, "document")
+
+	_, err = parseStoreExport([]byte(storeTestExport), "missing")
+	require.EqualError(t, err, `model "missing" not found in store export, which contains: 01HVMMBCMGZNT3SED4Z17ECXCA, 01HVMMBCMGZNT3SED4Z17ECXCB`)
+
+	// the model can't be guessed among several
+	_, err = parseStoreExport([]byte(storeTestExport), "")
+	require.ErrorContains(t, err, "store export contains 2 models, pass -model-id")
+}
+
+func TestParseStoreExport_ReadAuthorizationModelsResponse(t *testing.T) {
+	response := `{"authorization_models": ` + storeTestExport + `, "continuation_token": ""}`
+
+	model, err := parseStoreExport([]byte(response), "01HVMMBCMGZNT3SED4Z17ECXCA")
+	require.NoError(t, err)
+	require.Len(t, model.GetTypeDefinitions(), 2)
+	require.Equal(t, "document", model.GetTypeDefinitions()[1].GetType())
+
+	_, err = parseStoreExport([]byte(`{"authorization_models": []}`), "")
+	require.EqualError(t, err, "store export contains no models")
+}
+
+func TestLoadModel_StoreExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	require.NoError(t, os.WriteFile(path, []byte(storeTestExport), 0o644))
+
+	model, _, err := loadModel(path, "01HVMMBCMGZNT3SED4Z17ECXCA")
+	require.NoError(t, err)
+	require.Equal(t, "01HVMMBCMGZNT3SED4Z17ECXCA", model.GetId())
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"gonum.org/v1/gonum/graph/encoding"
+)
+
+// theme is a preset of coordinated colors for the background of a graph and
+// for its nodes and edges. The colors of individual nodes and edges, like the
+// blue of self references, still override it.
+type theme struct {
+	graph []encoding.Attribute
+	node  []encoding.Attribute
+	edge  []encoding.Attribute
+}
+
+// themes are the presets selectable with WithTheme, by name.
+var themes = map[string]*theme{
+	"light": {
+		graph: []encoding.Attribute{
+			{Key: "bgcolor", Value: "#ffffff"},
+			{Key: "fontcolor", Value: "#24292f"},
+		},
+		node: []encoding.Attribute{
+			{Key: "color", Value: "#24292f"},
+			{Key: "fillcolor", Value: "#f6f8fa"},
+			{Key: "fontcolor", Value: "#24292f"},
+			{Key: "style", Value: "filled"},
+		},
+		edge: []encoding.Attribute{
+			{Key: "color", Value: "#57606a"},
+			{Key: "fontcolor", Value: "#24292f"},
+		},
+	},
+	"dark": {
+		graph: []encoding.Attribute{
+			{Key: "bgcolor", Value: "#0d1117"},
+			{Key: "fontcolor", Value: "#c9d1d9"},
+		},
+		node: []encoding.Attribute{
+			{Key: "color", Value: "#8b949e"},
+			{Key: "fillcolor", Value: "#161b22"},
+			{Key: "fontcolor", Value: "#c9d1d9"},
+			{Key: "style", Value: "filled"},
+		},
+		edge: []encoding.Attribute{
+			{Key: "color", Value: "#8b949e"},
+			{Key: "fontcolor", Value: "#c9d1d9"},
+		},
+	},
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// modelFetchTimeout bounds how long fetching a model from a URL may take.
+const modelFetchTimeout = 30 * time.Second
+
+// isModelURL reports whether the model path is an http(s) URL to fetch the
+// model DSL from, rather than a local path.
+func isModelURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetchModel fetches the model DSL at url, such as a raw file of a Git host.
+func fetchModel(url string) (string, error) {
+	client := &http.Client{Timeout: modelFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch model: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch model: %s returned %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxModelSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch model: %w", err)
+	}
+	if len(body) > maxModelSize {
+		return "", fmt.Errorf("failed to fetch model: %s is larger than %d bytes", url, maxModelSize)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadModel_URL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/model.fga" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(serverTestModel))
+	}))
+	defer server.Close()
+
+	model, _, err := loadModel(server.URL+"/model.fga", "")
+	require.NoError(t, err)
+	require.Len(t, model.GetTypeDefinitions(), 2)
+
+	_, _, err = loadModel(server.URL+"/missing.fga", "")
+	require.ErrorContains(t, err, "returned 404 Not Found")
+}
+
+func TestLoadModel_URLTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat(" ", maxModelSize+1)))
+	}))
+	defer server.Close()
+
+	_, _, err := loadModel(server.URL, "")
+	require.ErrorContains(t, err, "is larger than")
+}
+
+func TestIsModelURL(t *testing.T) {
+	require.True(t, isModelURL("https://example.com/model.fga"))
+	require.True(t, isModelURL("http://localhost:8080/model.fga"))
+	require.False(t, isModelURL("model.fga"))
+	require.False(t, isModelURL("/models/http/model.fga"))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"time"
+)
+
+// watch polls the model at path every interval and calls onChange whenever
+// the modification time of one of its files changes, including once for the
+// initial state of the model. The files of a modular model are its module
+// files and manifest, if any, so that editing a module is noticed. It never
+// returns; errors reading the files are logged and polling continues.
+func watch(path string, interval time.Duration, onChange func()) {
+	w := &watcher{path: path, onChange: onChange}
+	for {
+		w.poll()
+		time.Sleep(interval)
+	}
+}
+
+// watcher tracks the modification times of the files of a model, see watch.
+type watcher struct {
+	path     string
+	onChange func()
+	// modTimes are the modification times of the files of the model, by
+	// file, as of the last successful poll.
+	modTimes map[string]time.Time
+	// lastErr is the error of the last poll, if any, so that an error that
+	// lasts is logged once rather than on every poll.
+	lastErr string
+}
+
+// poll calls onChange if the files of the model changed since the last poll.
+func (w *watcher) poll() {
+	modTimes, err := modelModTimes(w.path)
+	if err != nil {
+		if err.Error() != w.lastErr {
+			log.Printf("failed to stat model files: %v", err)
+			w.lastErr = err.Error()
+		}
+		return
+	}
+	w.lastErr = ""
+
+	if w.modTimes != nil && maps.EqualFunc(modTimes, w.modTimes, time.Time.Equal) {
+		return
+	}
+	w.modTimes = modTimes
+	w.onChange()
+}
+
+// modelModTimes returns the modification times of the files of the model at
+// path, by file: the file itself or, for a modular model, its module files
+// and manifest.
+func modelModTimes(path string) (map[string]time.Time, error) {
+	files := []string{path}
+	if isModularModelPath(path) {
+		moduleFiles, manifestPath, err := moduleFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		files = moduleFiles
+		if manifestPath != "" {
+			files = append(files, manifestPath)
+		}
+	}
+
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
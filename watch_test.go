@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher_ModularModel(t *testing.T) {
+	dir := t.TempDir()
+	module := filepath.Join(dir, "core.fga")
+	require.NoError(t, os.WriteFile(module, []byte("module core\ntype user\n"), 0o644))
+
+	changes := 0
+	w := &watcher{path: dir, onChange: func() { changes++ }}
+	w.poll()
+	require.Equal(t, 1, changes)
+
+	// nothing changed
+	w.poll()
+	require.Equal(t, 1, changes)
+
+	// editing a module doesn't change the modification time of the
+	// directory, but is noticed still
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(module, later, later))
+	w.poll()
+	require.Equal(t, 2, changes)
+
+	// neither does adding one to a subdirectory
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "docs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "docs.fga"), []byte("module docs\ntype document\n"), 0o644))
+	w.poll()
+	require.Equal(t, 3, changes)
+}
+
+func TestWatcher_LogsLastingErrorsOnce(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	path := filepath.Join(t.TempDir(), "model.fga")
+	changes := 0
+	w := &watcher{path: path, onChange: func() { changes++ }}
+	for i := 0; i < 3; i++ {
+		w.poll()
+	}
+	require.Zero(t, changes)
+	require.Equal(t, 1, strings.Count(logged.String(), "failed to stat model files"))
+
+	require.NoError(t, os.WriteFile(path, []byte("model\n  schema 1.1\ntype user\n"), 0o644))
+	w.poll()
+	require.Equal(t, 1, changes)
+
+	// the error is logged again if it comes back after a successful poll
+	require.NoError(t, os.Remove(path))
+	w.poll()
+	require.Equal(t, 2, strings.Count(logged.String(), "failed to stat model files"))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// The weights of the edges approximate what evaluating them costs when
+// planning ListObjects queries, mirroring the weighted graph OpenFGA plans
+// queries with:
+//
+//   - direct assignments, computed usersets and operator edges weigh 1, as
+//     they are resolved with a single lookup or none at all;
+//   - tuple to usersets weigh 2, as the tupleset has to be read before the
+//     related relation can be evaluated;
+//   - recursive edges, i.e. edges between relations of the same cycle, weigh
+//     recursiveEdgeWeight more than their kind, as they may have to be
+//     evaluated any number of times.
+var edgeKindWeights = map[edgeKind]int{
+	directEdge:         1,
+	computedEdge:       1,
+	tupleToUsersetEdge: 2,
+	operatorEdge:       1,
+}
+
+// recursiveEdgeWeight is added to the weight of edges that take part in a
+// cycle.
+const recursiveEdgeWeight = 2
+
+// AssignWeights assigns a weight to every line currently in the graph, based
+// on its kind and on whether it is recursive.
+func (g *dotEncodingGraph) AssignWeights() {
+	rg := g.RelationGraph()
+
+	// relations in the same strongly connected component of more than one
+	// relation are on a cycle with each other
+	component := map[string]int{}
+	for i, scc := range topo.TarjanSCC(rg) {
+		if len(scc) < 2 {
+			continue
+		}
+		for _, n := range scc {
+			component[rg.reverseMapping[n.ID()]] = i + 1
+		}
+	}
+
+	for _, l := range g.SortedLines() {
+		l.weight = edgeKindWeights[l.kind]
+		if l.kind == operatorEdge {
+			// operator edges stay within the rewrite of one relation
+			continue
+		}
+
+		from, to := g.relationOf(l.From()), g.relationOf(l.To())
+		if from == to || (component[from] != 0 && component[from] == component[to]) {
+			l.weight += recursiveEdgeWeight
+		}
+	}
+}
+
+// LabelWeights adds the weight of every line currently in the graph as its
+// fga_weight attribute. It isn't the graphviz weight attribute, which would
+// change the layout of the graph.
+func (g *dotEncodingGraph) LabelWeights() {
+	for _, l := range g.SortedLines() {
+		if l.weight > 0 {
+			l.attrs["fga_weight"] = strconv.Itoa(l.weight)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignWeights(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent
+		type document
+			relations
+				define parent: [folder]
+				define viewer: viewer from parent
+		type report
+			relations
+				define document: [document]
+				define reader: viewer from document`)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(model, newOptions())
+	g.RemoveNodesWithNoEdges()
+	rg := g.RelationGraph()
+
+	weights := map[string]int{}
+	for _, l := range rg.SortedLines() {
+		weights[rg.describeLine(l)] = l.weight
+	}
+
+	require.Equal(t, map[string]int{
+		"folder -> document#parent":   1,
+		"folder -> folder#parent":     1,
+		"user -> folder#viewer":       1,
+		"document -> report#document": 1,
+		// a tuple to userset nested in another one
+		"document#viewer -> report#reader (viewer from report#document)": 2,
+		"folder#viewer -> document#viewer (viewer from document#parent)": 2,
+		// a recursive tuple to userset
+		"folder#viewer -> folder#viewer (viewer from folder#parent)": 4,
+	}, weights)
+}
+
+func TestWriter_Weights(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent`
+
+	actualDOT, _, err := Writer(model, WithWeights())
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, "fga_weight=4")
+
+	actualDOT, _, err = Writer(model)
+	require.NoError(t, err)
+	require.NotContains(t, actualDOT, "fga_weight")
+}
@@ -1,33 +1,94 @@
 package main
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"regexp"
 	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
 	parser "github.com/openfga/language/pkg/go/transformer"
 	"github.com/openfga/openfga/pkg/typesystem"
-	"gonum.org/v1/gonum/graph/encoding/dot"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
 	"gonum.org/v1/gonum/graph/topo"
+	"google.golang.org/protobuf/proto"
 )
 
-func buildGraph(model *openfgav1.AuthorizationModel) *dotEncodingGraph {
+// anyUserNodeName is the label of the node direct assignments are drawn from
+// in untyped models, where any user can be directly related to a relation.
+const anyUserNodeName = "any user"
+
+// nodeLabel returns the label of the node for the users of typeName, e.g.
+// "user", or, if relation is set, for the userset typeName#relation, e.g.
+// "group#member", or, if wildcard is set, for the wildcard typeName:*, e.g.
+// "user:*". A condition that is part of the node instead of its edges is
+// placed after the type, e.g. "user[with condition1]". Every label is built
+// here, so that labels referring to the same node are always identical.
+func nodeLabel(typeName, relation string, wildcard bool, condition string) string {
+	label := strings.TrimSpace(typeName)
+	if condition = strings.TrimSpace(condition); condition != "" {
+		label = fmt.Sprintf("%s[with %s]", label, condition)
+	}
+	if relation = strings.TrimSpace(relation); relation != "" {
+		return fmt.Sprintf("%s#%s", label, relation)
+	}
+	if wildcard {
+		return fmt.Sprintf("%s:*", label)
+	}
+	return label
+}
+
+// graphBuilder holds the state shared while walking the rewrites of a model to
+// build its graph.
+type graphBuilder struct {
+	model    *openfgav1.AuthorizationModel
+	typesys  *typesystem.TypeSystem
+	typedefs []*openfgav1.TypeDefinition // the type definitions of model, sorted by type name
+	g        *dotEncodingGraph
+	opts     *options
+	warnings []string
+
+	// operators are the intersections and exclusions enclosing the rewrite
+	// being walked, outermost first
+	operators []string
+}
+
+// buildGraph returns the graph of the model along with warnings about likely
+// modeling mistakes found while building it.
+func buildGraph(model *openfgav1.AuthorizationModel, o *options) (*dotEncodingGraph, []string) {
 	typesys := typesystem.New(model)
 
-	// sort type names to guarantee stable outcome
-	sort.SliceStable(model.GetTypeDefinitions(), func(i, j int) bool {
-		return slices.IsSorted([]string{model.GetTypeDefinitions()[i].Type, model.GetTypeDefinitions()[j].Type})
+	// sort type names to guarantee stable outcome. A copy is sorted, so that
+	// the model can be shared between concurrent calls. Rewrites may refer to
+	// relations of types that are processed later; their nodes are created by
+	// the first reference and reused when the type is processed, since every
+	// node is looked up by its label.
+	typedefs := slices.Clone(model.GetTypeDefinitions())
+	slices.SortStableFunc(typedefs, func(a, b *openfgav1.TypeDefinition) int {
+		return strings.Compare(a.GetType(), b.GetType())
 	})
 
-	g := newDotEncodingGraph()
+	b := &graphBuilder{typesys: typesys, typedefs: typedefs, g: newDotEncodingGraph(), opts: o, model: model}
+	g := b.g
 
-	for _, typedef := range model.GetTypeDefinitions() {
+	if b.untyped() {
+		b.warn("model uses schema %s: relations are untyped, direct assignments are drawn from %q", model.GetSchemaVersion(), anyUserNodeName)
+	}
+
+	for _, typedef := range typedefs {
 		typeName := typedef.GetType()
 
-		g.AddOrGetNode(typeName)
-		g.AddOrGetNode(typeName + ":*")
+		typeNodeName := nodeLabel(typeName, "", false, "")
+		b.setModuleName(g.AddOrGetNode(typeNodeName).(*dotNode), typeNodeName)
+		g.AddOrGetNode(nodeLabel(typeName, "", true, ""))
 
 		// sort relation names to guarantee stable outcome
 		sortedRelationNames := make([]string, 0, len(typedef.GetRelations()))
@@ -37,91 +98,384 @@ func buildGraph(model *openfgav1.AuthorizationModel) *dotEncodingGraph {
 		sort.Strings(sortedRelationNames)
 
 		for _, relation := range sortedRelationNames {
-			g.AddOrGetNode(fmt.Sprintf("%s#%s", typeName, relation))
+			relationNodeName := nodeLabel(typeName, relation, false, "")
+			relationNode := g.AddOrGetNode(relationNodeName).(*dotNode)
+			b.setModuleName(relationNode, relationNodeName)
+			if o.inlineAssignable {
+				b.inlineAssignableTypes(relationNode, typedef, relation)
+			}
 
-			rewrite := typedef.GetRelations()[relation]
-			if _, err := typesystem.WalkUsersetRewrite(rewrite, rewriteHandler(typesys, g, typeName, relation)); err != nil {
-				panic(err)
+			for _, relatedType := range typedef.GetMetadata().GetRelations()[relation].GetDirectlyRelatedUserTypes() {
+				conditionName := relatedType.GetCondition()
+				if _, ok := model.GetConditions()[conditionName]; conditionName != "" && !ok {
+					b.warn("relation %s#%s references undefined condition %s", typeName, relation, conditionName)
+				}
 			}
+
+			b.warnSelfDefined(typedef.GetRelations()[relation], typeName, relation)
+			b.walk(typedef.GetRelations()[relation], typeName, relation, relationNodeName, 0, 0)
 		}
 	}
 
-	return g
+	g.AssignWeights()
+
+	return g, b.warnings
 }
 
-func rewriteHandler(typesys *typesystem.TypeSystem, g *dotEncodingGraph, typeName, relation string) typesystem.WalkUsersetRewriteHandler {
-	relationNodeName := fmt.Sprintf("%s#%s", typeName, relation)
+// inlineAssignableTypes lists the directly related user types of the relation
+// in the label of its node, below the name of the relation.
+func (b *graphBuilder) inlineAssignableTypes(n *dotNode, typedef *openfgav1.TypeDefinition, relation string) {
+	relatedTypes := typedef.GetMetadata().GetRelations()[relation].GetDirectlyRelatedUserTypes()
+	if len(relatedTypes) == 0 {
+		return
+	}
 
-	return func(r *openfgav1.Userset) interface{} {
-		switch rw := r.Userset.(type) {
-		case *openfgav1.Userset_This:
-			assignableRelations, err := typesys.GetDirectlyRelatedUserTypes(typeName, relation)
-			if err != nil {
-				panic(err)
-			}
+	descriptions := make([]string, 0, len(relatedTypes))
+	for _, relatedType := range relatedTypes {
+		if b.opts.noConditions {
+			relatedType = &openfgav1.RelationReference{Type: relatedType.GetType(), RelationOrWildcard: relatedType.GetRelationOrWildcard()}
+		}
+		if description := describeRelatedType(relatedType); !slices.Contains(descriptions, description) {
+			descriptions = append(descriptions, description)
+		}
+	}
+	n.attrs["label"] = fmt.Sprintf(`"%s\n[%s]"`, nodeLabel(typedef.GetType(), relation, false, ""), strings.Join(descriptions, ", "))
+}
 
-			for _, assignableRelation := range assignableRelations {
-				assignableType := assignableRelation.GetType()
-				conditionName := assignableRelation.GetCondition()
-				if conditionName != "" {
-					assignableType = fmt.Sprintf(" %s[with %s]", assignableType, conditionName)
-				}
+// setModuleName adds the name of the module that defines the node labeled
+// label, if known, to the tooltip of the node. Graphviz shows the tooltip when
+// hovering the node in SVG output.
+func (b *graphBuilder) setModuleName(n *dotNode, label string) {
+	if moduleName, ok := b.opts.moduleNames[label]; ok {
+		n.attrs["tooltip"] = fmt.Sprintf("module %s", moduleName)
+	}
+}
 
-				if assignableRelation.GetRelationOrWildcard() != nil {
-					assignableRelationRef := assignableRelation.GetRelation()
-					if assignableRelationRef != "" {
-						assignableRelationNodeName := fmt.Sprintf("%s#%s", assignableType, assignableRelationRef)
+// setTooltip describes the rewrite an edge was drawn for in its tooltip, when
+// tooltips are enabled. Graphviz shows the tooltip when hovering the edge in
+// SVG output.
+func (b *graphBuilder) setTooltip(line *dotLine, format string, args ...interface{}) {
+	if line == nil || !b.opts.tooltips {
+		return
+	}
 
-						g.AddEdge(assignableRelationNodeName, relationNodeName, "", "")
-					}
+	line.attrs["tooltip"] = fmt.Sprintf(format, args...)
+}
 
-					wildcardRelationRef := assignableRelation.GetWildcard()
-					if wildcardRelationRef != nil {
-						wildcardRelationNodeName := fmt.Sprintf("%s:*", assignableType)
+// setUserType records that a direct edge is drawn from concrete users of the
+// given type, so that it can be filtered by user type.
+func (b *graphBuilder) setUserType(line *dotLine, userType string) {
+	if line != nil {
+		line.userType = userType
+	}
+}
 
-						g.AddEdge(wildcardRelationNodeName, relationNodeName, "", "")
-					}
-				} else {
-					g.AddEdge(assignableType, relationNodeName, "", "")
+// describeRelatedType formats a directly related user type the way it is
+// written in the DSL, e.g. "group#member" or "user:* with condition1".
+func describeRelatedType(relatedType *openfgav1.RelationReference) string {
+	description := relatedType.GetType()
+	if relation := relatedType.GetRelation(); relation != "" {
+		description = fmt.Sprintf("%s#%s", description, relation)
+	}
+	if relatedType.GetWildcard() != nil {
+		description = fmt.Sprintf("%s:*", description)
+	}
+	if condition := relatedType.GetCondition(); condition != "" {
+		description = fmt.Sprintf("%s with %s", description, condition)
+	}
+
+	return description
+}
+
+// untyped reports whether the model uses schema 1.0, in which relations do
+// not declare the types of users that can be related to them.
+func (b *graphBuilder) untyped() bool {
+	return b.model.GetSchemaVersion() == typesystem.SchemaVersion1_0
+}
+
+// typesDefining returns a reference to every type that defines relation. In
+// untyped models the object of a tupleset can be of any type, so these are the
+// types a tuple to userset can be rewritten through.
+func (b *graphBuilder) typesDefining(relation string) []*openfgav1.RelationReference {
+	var refs []*openfgav1.RelationReference
+	for _, typedef := range b.typedefs {
+		if _, ok := typedef.GetRelations()[relation]; ok {
+			refs = append(refs, typesystem.DirectRelationReference(typedef.GetType(), ""))
+		}
+	}
+	return refs
+}
+
+func (b *graphBuilder) warn(format string, args ...interface{}) {
+	b.warnings = append(b.warnings, fmt.Sprintf(format, args...))
+}
+
+// assignableConditions returns where the condition of a directly related user
+// type goes: into the label of its node, onto its edge if conditions are
+// collapsed onto the edges, or nowhere if conditions are stripped.
+func (b *graphBuilder) assignableConditions(relatedType *openfgav1.RelationReference) (labelCondition, edgeCondition string) {
+	if b.opts.noConditions {
+		return "", ""
+	}
+	if b.opts.collapseConditions {
+		return "", relatedType.GetCondition()
+	}
+
+	return relatedType.GetCondition(), ""
+}
+
+// addEdge draws an edge like AddEdge, recording the intersections and
+// exclusions enclosing the rewrite being walked on it.
+func (b *graphBuilder) addEdge(from, to string, kind edgeKind, optionalHeadLabel, optionalCondition string) *dotLine {
+	line := b.g.AddEdge(from, to, kind, optionalHeadLabel, optionalCondition)
+	if line == nil {
+		return nil
+	}
+
+	for _, operator := range b.operators {
+		if !slices.Contains(line.operators, operator) {
+			line.operators = append(line.operators, operator)
+		}
+	}
+	return line
+}
+
+// walk draws the edges for the rewrite of typeName#relation into the node
+// labeled target. Boolean operators are drawn as operator nodes feeding the
+// target when operator nodes are enabled; otherwise their children are drawn
+// straight into the target. index is the position of rewrite among the
+// children of its parent operator, and depth is the nesting depth of target.
+func (b *graphBuilder) walk(rewrite *openfgav1.Userset, typeName, relation, target string, index, depth int) {
+	switch rw := rewrite.Userset.(type) {
+	case *openfgav1.Userset_This:
+		if b.untyped() {
+			line := b.addEdge(anyUserNodeName, target, directEdge, "", "")
+			b.setTooltip(line, "direct assignment: any user")
+			return
+		}
+
+		assignableRelations, err := b.typesys.GetDirectlyRelatedUserTypes(typeName, relation)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, assignableRelation := range assignableRelations {
+			assignableType := assignableRelation.GetType()
+			labelCondition, conditionName := b.assignableConditions(assignableRelation)
+
+			// a reference is either to a userset, e.g. group#member, or to a
+			// wildcard, e.g. user:*; there is no wildcard of a userset
+			if assignableRelation.GetRelationOrWildcard() != nil {
+				assignableRelationRef := assignableRelation.GetRelation()
+				if assignableRelationRef != "" {
+					assignableRelationNodeName := nodeLabel(assignableType, assignableRelationRef, false, labelCondition)
+
+					line := b.addEdge(assignableRelationNodeName, target, directEdge, "", conditionName)
+					b.setTooltip(line, "direct assignment: %s", describeRelatedType(assignableRelation))
 				}
+
+				wildcardRelationRef := assignableRelation.GetWildcard()
+				if wildcardRelationRef != nil {
+					wildcardRelationNodeName := nodeLabel(assignableType, "", true, labelCondition)
+
+					line := b.addEdge(wildcardRelationNodeName, target, directEdge, "", conditionName)
+					b.setTooltip(line, "direct assignment: %s", describeRelatedType(assignableRelation))
+					b.setUserType(line, assignableRelation.GetType())
+				}
+			} else {
+				line := b.addEdge(nodeLabel(assignableType, "", false, labelCondition), target, directEdge, "", conditionName)
+				b.setTooltip(line, "direct assignment: %s", describeRelatedType(assignableRelation))
+				b.setUserType(line, assignableRelation.GetType())
 			}
-		case *openfgav1.Userset_ComputedUserset:
-			rewrittenRelation := rw.ComputedUserset.GetRelation()
-			rewritten, err := typesys.GetRelation(typeName, rewrittenRelation)
-			if err != nil {
-				panic(err)
+		}
+	case *openfgav1.Userset_ComputedUserset:
+		rewrittenRelation := rw.ComputedUserset.GetRelation()
+		// a computed userset always refers to a relation of the same type
+		rewritten, err := b.typesys.GetRelation(typeName, rewrittenRelation)
+		if err != nil {
+			b.warn("relation %s#%s references undefined relation %s#%s", typeName, relation, typeName, rewrittenRelation)
+			return
+		}
+
+		rewrittenNodeName := nodeLabel(typeName, rewritten.GetName(), false, "")
+		line := b.addEdge(rewrittenNodeName, target, computedEdge, "", "")
+		b.setTooltip(line, "computed userset: %s", rewrittenRelation)
+	case *openfgav1.Userset_TupleToUserset:
+		tupleset := rw.TupleToUserset.GetTupleset().GetRelation()
+		rewrittenRelation := rw.TupleToUserset.GetComputedUserset().GetRelation()
+
+		tuplesetRel, err := b.typesys.GetRelation(typeName, tupleset)
+		if err != nil {
+			b.warn("relation %s#%s references undefined relation %s#%s", typeName, relation, typeName, tupleset)
+			return
+		}
+
+		directlyRelatedTypes := tuplesetRel.GetTypeInfo().GetDirectlyRelatedUserTypes()
+		if b.untyped() {
+			directlyRelatedTypes = b.typesDefining(rewrittenRelation)
+		} else if len(directlyRelatedTypes) == 0 {
+			b.warn("relation %s#%s references %s from %s, which is unsatisfiable: %s#%s has no directly related user types",
+				typeName, relation, rewrittenRelation, tupleset, typeName, tupleset)
+		}
+		for _, relatedType := range directlyRelatedTypes {
+			// the tupleset may relate types that don't define the relation,
+			// which are skipped rather than drawn from a node of a relation
+			// that doesn't exist
+			if _, err := b.typesys.GetRelation(relatedType.GetType(), rewrittenRelation); err != nil {
+				continue
 			}
 
-			rewrittenNodeName := fmt.Sprintf("%s#%s", typeName, rewritten.GetName())
-			g.AddEdge(rewrittenNodeName, relationNodeName, "", "dashed")
-		case *openfgav1.Userset_TupleToUserset:
-			tupleset := rw.TupleToUserset.GetTupleset().GetRelation()
-			rewrittenRelation := rw.TupleToUserset.GetComputedUserset().GetRelation()
+			labelCondition, conditionName := b.assignableConditions(relatedType)
+			rewrittenNodeName := nodeLabel(relatedType.GetType(), rewrittenRelation, false, labelCondition)
+			conditionedOnNodeName := fmt.Sprintf("(%s from %s)", rewrittenRelation, nodeLabel(typeName, tuplesetRel.GetName(), false, ""))
 
-			tuplesetRel, err := typesys.GetRelation(typeName, tupleset)
-			if err != nil {
-				panic(err)
+			line := b.addEdge(rewrittenNodeName, target, tupleToUsersetEdge, conditionedOnNodeName, conditionName)
+			if line != nil {
+				line.tupleset = nodeLabel(typeName, tuplesetRel.GetName(), false, "")
 			}
+			if conditionName := relatedType.GetCondition(); conditionName != "" {
+				// like a direct assignment, the tooltip tells the conditioned
+				// tupleset apart from the unconditioned one
+				b.setTooltip(line, "tuple-to-userset: %s from %s with %s", rewrittenRelation, tupleset, conditionName)
+			} else {
+				b.setTooltip(line, "tuple-to-userset: %s from %s", rewrittenRelation, tupleset)
+			}
+		}
+	case *openfgav1.Userset_Union:
+		b.walkOperator("or", rw.Union.GetChild(), typeName, relation, target, index, depth)
+	case *openfgav1.Userset_Intersection:
+		b.walkOperator("and", rw.Intersection.GetChild(), typeName, relation, target, index, depth)
+	case *openfgav1.Userset_Difference:
+		children := []*openfgav1.Userset{rw.Difference.GetBase(), rw.Difference.GetSubtract()}
+		b.walkOperator("but not", children, typeName, relation, target, index, depth)
+	default:
+		panic("unexpected userset rewrite type encountered")
+	}
+}
 
-			directlyRelatedTypes := tuplesetRel.GetTypeInfo().GetDirectlyRelatedUserTypes()
-			for _, relatedType := range directlyRelatedTypes {
-				assignableType := relatedType.GetType()
-				conditionName := relatedType.GetCondition()
-				if conditionName != "" {
-					assignableType = fmt.Sprintf(" %s[with %s]", assignableType, conditionName)
-				}
-				rewrittenNodeName := fmt.Sprintf("%s#%s", assignableType, rewrittenRelation)
-				conditionedOnNodeName := fmt.Sprintf("(%s#%s)", typeName, tuplesetRel.GetName())
+// walkOperator draws the children of a boolean operator, either through an
+// operator node feeding target or, if operator nodes are disabled, straight
+// into target. Unions always get an operator node, so that the alternatives
+// of a union can be told apart from the operands of other operators, and so
+// do operators nested in other operators, e.g. the "and" of
+// "(a and b) or c", so that their grouping isn't flattened into the outer
+// operator.
+func (b *graphBuilder) walkOperator(operator string, children []*openfgav1.Userset, typeName, relation, target string, index, depth int) {
+	b.warnDuplicateOperands(operator, children, typeName, relation)
+
+	// depth counts the operator nodes above, and b.operators the
+	// intersections and exclusions drawn without a node
+	nested := depth > 0 || len(b.operators) > 0
+	if b.opts.operatorNodes || operator == "or" || nested {
+		relationNodeName := nodeLabel(typeName, relation, false, "")
+		operatorNodeName := fmt.Sprintf("%s/%d-%s", target, index, operator)
+
+		b.g.AddOperatorNode(operatorNodeName, operator, relationNodeName, depth+1)
+		b.addEdge(operatorNodeName, target, operatorEdge, "", "")
+
+		target = operatorNodeName
+		depth++
+	}
+
+	if operator == "and" || operator == "but not" {
+		b.operators = append(b.operators, operator)
+		defer func() {
+			b.operators = b.operators[:len(b.operators)-1]
+		}()
+	}
+
+	for i, child := range children {
+		added := b.g.edgeCounter
+		b.walk(child, typeName, relation, target, i, depth)
+
+		if operator == "but not" && i == 1 {
+			b.g.markSubtracted(target, added)
+		}
+	}
+}
+
+// warnSelfDefined warns about a relation that can only be granted through
+// itself, e.g. "define viewer: viewer" or "define viewer: viewer and editor".
+// Such a relation has no base case, so it never grants anything. Cycle
+// detection doesn't report it, as a relation referring to itself is a loop
+// rather than a cycle.
+func (b *graphBuilder) warnSelfDefined(rewrite *openfgav1.Userset, typeName, relation string) {
+	if !hasBaseCase(rewrite, relation) {
+		b.warn("relation %s#%s is defined only in terms of itself, so it can never be granted", typeName, relation)
+	}
+}
 
-				g.AddEdge(rewrittenNodeName, relationNodeName, conditionedOnNodeName, "")
+// hasBaseCase reports whether rewrite can grant relation without the relation
+// itself as a computed userset. Direct assignments, tuple to usersets and
+// other relations are assumed to be able to grant.
+func hasBaseCase(rewrite *openfgav1.Userset, relation string) bool {
+	switch rw := rewrite.Userset.(type) {
+	case *openfgav1.Userset_ComputedUserset:
+		return rw.ComputedUserset.GetRelation() != relation
+	case *openfgav1.Userset_Union:
+		for _, child := range rw.Union.GetChild() {
+			if hasBaseCase(child, relation) {
+				return true
 			}
-		case *openfgav1.Userset_Union:
-		case *openfgav1.Userset_Intersection:
-		case *openfgav1.Userset_Difference:
-		default:
-			panic("unexpected userset rewrite type encountered")
 		}
-		return nil
+		return false
+	case *openfgav1.Userset_Intersection:
+		for _, child := range rw.Intersection.GetChild() {
+			if !hasBaseCase(child, relation) {
+				return false
+			}
+		}
+		return true
+	case *openfgav1.Userset_Difference:
+		return hasBaseCase(rw.Difference.GetBase(), relation)
+	default:
+		return true
+	}
+}
+
+// warnDuplicateOperands warns about every operand of an operator that is
+// identical to an earlier operand of the same operator, e.g. the second editor
+// of "editor or editor". Duplicates don't change what the rewrite grants, but
+// they usually are copy-paste errors in the DSL.
+func (b *graphBuilder) warnDuplicateOperands(operator string, children []*openfgav1.Userset, typeName, relation string) {
+	for i, child := range children {
+		for _, previous := range children[:i] {
+			if proto.Equal(previous, child) {
+				b.warn("relation %s#%s has a duplicate operand %s in its %q expression", typeName, relation, describeRewrite(child), operator)
+				break
+			}
+		}
+	}
+}
+
+// describeRewrite formats a rewrite the way it is written in the DSL, e.g.
+// "viewer from parent" or "(editor and owner)". Direct assignments are
+// described as "[...]", since their types are listed in the metadata of the
+// relation rather than in the rewrite.
+func describeRewrite(rewrite *openfgav1.Userset) string {
+	describeOperator := func(operator string, children []*openfgav1.Userset) string {
+		operands := make([]string, 0, len(children))
+		for _, child := range children {
+			operands = append(operands, describeRewrite(child))
+		}
+		return fmt.Sprintf("(%s)", strings.Join(operands, fmt.Sprintf(" %s ", operator)))
+	}
+
+	switch rw := rewrite.Userset.(type) {
+	case *openfgav1.Userset_This:
+		return "[...]"
+	case *openfgav1.Userset_ComputedUserset:
+		return rw.ComputedUserset.GetRelation()
+	case *openfgav1.Userset_TupleToUserset:
+		return fmt.Sprintf("%s from %s", rw.TupleToUserset.GetComputedUserset().GetRelation(), rw.TupleToUserset.GetTupleset().GetRelation())
+	case *openfgav1.Userset_Union:
+		return describeOperator("or", rw.Union.GetChild())
+	case *openfgav1.Userset_Intersection:
+		return describeOperator("and", rw.Intersection.GetChild())
+	case *openfgav1.Userset_Difference:
+		return describeOperator("but not", []*openfgav1.Userset{rw.Difference.GetBase(), rw.Difference.GetSubtract()})
+	default:
+		return "?"
 	}
 }
 
@@ -133,55 +487,705 @@ type CycleInformation struct {
 	// They should be forbidden when calling WriteAuthorizationModel API.
 	definitiveCycles int
 	cycles           [][]string
+	// the same cycles as cycles, with the kind of every edge along them.
+	detailedCycles []Cycle
+	// the subset of cycles that involve computed relations only.
+	definitiveCyclePaths [][]string
+	// relations with no incoming or outgoing edges. These are usually
+	// relations that were defined but never wired up.
+	isolatedRelations []string
+	// human-readable descriptions of likely modeling mistakes.
+	warnings []string
+	// human-readable descriptions of patterns that are usually intended but
+	// worth a second look, e.g. relations assignable to their own userset.
+	// Unlike warnings and cycles, they are only reported when enabled.
+	notices []string
+	// the size and shape of the graph of the whole model.
+	metrics GraphMetrics
 }
 
-func parseCycleInformation(g *dotEncodingGraph) *CycleInformation {
+// Cycle is a cycle of the relation graph, as the edges along it in order.
+// The last edge leads back to the relation the first one starts from.
+type Cycle struct {
+	Edges []CycleEdge
+	// Operators are the intersections and exclusions, "and" and "but not",
+	// the edges of the cycle pass through, sorted. A cycle through them is
+	// only followed while every other operand grants too, as opposed to a
+	// cycle of unions only.
+	Operators []string
+	// Definitive reports whether every edge is a computed userset, in which
+	// case OpenFGA rejects the model. Other cycles are only followed when
+	// tuples close them.
+	Definitive bool
+}
+
+// CycleEdge is an edge along a cycle, from one relation to the relation it
+// grants, and the kind of rewrite it is drawn for, e.g. "computed userset".
+type CycleEdge struct {
+	From string
+	To   string
+	Kind string
+}
+
+func parseCycleInformation(g *dotEncodingGraph, pathsInCycles [][]graph.Node) *CycleInformation {
 	result := &CycleInformation{}
-	pathsInCycles := topo.DirectedCyclesIn(g)
 
 	// convertedCycles has nicely formatted nodes, like "document#viewer"
 	convertedCycles := make([][]string, 0)
+	seen := map[string]bool{}
 	for _, nodesInCycle := range pathsInCycles {
+		if len(nodesInCycle) == 0 {
+			continue
+		}
+
+		nodesInCycle = canonicalCycle(nodesInCycle)
+		ids := make([]int64, 0, len(nodesInCycle))
+		for _, n := range nodesInCycle {
+			ids = append(ids, n.ID())
+		}
+		key := fmt.Sprint(ids)
+		if seen[key] {
+			// a rotation of a cycle that was already counted
+			continue
+		}
+		seen[key] = true
+
 		inner := make([]string, 0)
+		var cycle Cycle
+		possible := false
 		for i, node := range nodesInCycle {
 			from := node.ID()
 			inner = append(inner, g.reverseMapping[node.ID()])
 			if i != len(nodesInCycle)-1 {
 				to := nodesInCycle[i+1].ID()
 				lines := g.Lines(from, to)
+				// of parallel edges, the one that makes the cycle possible
+				// rather than definitive is the one reported
+				var reported *dotLine
 				for {
 					if !lines.Next() {
 						break
 					}
-					l := lines.Line()
-					if g.lines[fmt.Sprintf("%v-%v-%v", from, to, l.ID())].attrs["style"] != "dashed" {
+					reported = g.lines[lineKey(from, to, lines.Line().ID())]
+					if kind := reported.kind; kind == directEdge || kind == tupleToUsersetEdge {
 						// it's not a computed userset, so it's a possible cycle, not a definitive one
-						result.possibleCycles++
+						possible = true
 						break
 					}
 				}
+				cycle.Edges = append(cycle.Edges, CycleEdge{
+					From: g.reverseMapping[from],
+					To:   g.reverseMapping[to],
+					Kind: reported.kind.String(),
+				})
+				for _, operator := range reported.operators {
+					if !slices.Contains(cycle.Operators, operator) {
+						cycle.Operators = append(cycle.Operators, operator)
+					}
+				}
 			}
 		}
 		convertedCycles = append(convertedCycles, inner)
+		sort.Strings(cycle.Operators)
+		cycle.Definitive = !possible
+		result.detailedCycles = append(result.detailedCycles, cycle)
+		if possible {
+			result.possibleCycles++
+		} else {
+			result.definitiveCyclePaths = append(result.definitiveCyclePaths, inner)
+		}
 	}
 
 	result.cycles = convertedCycles
-	result.definitiveCycles = len(result.cycles) - result.possibleCycles
+	result.definitiveCycles = len(result.definitiveCyclePaths)
 	return result
 }
 
+// canonicalCycle returns the cycle path rotated to start at its node with the
+// lowest ID, with the first node repeated at the end. topo.DirectedCyclesIn
+// returns closed paths; an open path is closed so that the edge from its last
+// node back to its first is examined too.
+func canonicalCycle(path []graph.Node) []graph.Node {
+	if path[0].ID() == path[len(path)-1].ID() {
+		path = path[:len(path)-1]
+	}
+
+	lowest := 0
+	for i, n := range path {
+		if n.ID() < path[lowest].ID() {
+			lowest = i
+		}
+	}
+
+	canonical := make([]graph.Node, 0, len(path)+1)
+	canonical = append(canonical, path[lowest:]...)
+	canonical = append(canonical, path[:lowest]...)
+	return append(canonical, canonical[0])
+}
+
+// ParseError is returned when the model DSL cannot be parsed. Each of the
+// underlying syntax errors reports the line and column it was found at.
+type ParseError struct {
+	errs []error
+	// file is the name of the file that failed to parse, if known.
+	file string
+	// lineOffset is subtracted from the reported line numbers when the parsed
+	// source had lines prepended to it, e.g. the header of a module file.
+	lineOffset int
+}
+
+var syntaxErrorLine = regexp.MustCompile(`line=(\d+)`)
+
+func (e *ParseError) Error() string {
+	msgs := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		msg := err.Error()
+		if e.lineOffset != 0 {
+			msg = syntaxErrorLine.ReplaceAllStringFunc(msg, func(match string) string {
+				line, _ := strconv.Atoi(strings.TrimPrefix(match, "line="))
+				return fmt.Sprintf("line=%d", line-e.lineOffset)
+			})
+		}
+		msgs = append(msgs, msg)
+	}
+
+	if e.file != "" {
+		return fmt.Sprintf("%s: parse error: %s", e.file, strings.Join(msgs, "; "))
+	}
+
+	return fmt.Sprintf("parse error: %s", strings.Join(msgs, "; "))
+}
+
+func (e *ParseError) Unwrap() []error {
+	return e.errs
+}
+
+// parseModel transforms the DSL into an AuthorizationModel, converting the
+// transformer's syntax errors into a ParseError.
+func parseModel(modelString string) (*openfgav1.AuthorizationModel, error) {
+	model, err := parser.TransformDSLToProto(modelString)
+	if err != nil {
+		var syntaxErrs *multierror.Error
+		if errors.As(err, &syntaxErrs) {
+			return nil, &ParseError{errs: syntaxErrs.Errors}
+		}
+
+		return nil, &ParseError{errs: []error{err}}
+	}
+
+	return model, nil
+}
+
+// cycleSubgraph returns a new graph containing only the nodes and edges along
+// the given cycles, which are paths of node labels.
+func cycleSubgraph(g *dotEncodingGraph, cycles [][]string) *dotEncodingGraph {
+	inCycle := map[[2]string]bool{}
+	for _, cycle := range cycles {
+		for i := 0; i < len(cycle)-1; i++ {
+			inCycle[[2]string{cycle[i], cycle[i+1]}] = true
+		}
+	}
+
+	return g.Subgraph(func(l *dotLine) bool {
+		return inCycle[[2]string{g.relationOf(l.From()), g.relationOf(l.To())}]
+	})
+}
+
+// userTypesSubgraph returns a new graph without the edges drawn from concrete
+// users of the hidden types or, if only is not empty, of the types not in
+// only. Edges drawn from relations are always kept.
+func userTypesSubgraph(g *dotEncodingGraph, hidden, only []string) *dotEncodingGraph {
+	return g.Subgraph(func(l *dotLine) bool {
+		if l.userType == "" {
+			return true
+		}
+		if slices.Contains(hidden, l.userType) {
+			return false
+		}
+		return len(only) == 0 || slices.Contains(only, l.userType)
+	})
+}
+
+// typesSubgraph returns a new graph containing only the relations of the
+// given types along with their immediate neighbors.
+func typesSubgraph(g *dotEncodingGraph, types []string) *dotEncodingGraph {
+	isRelationOfTypes := func(label string) bool {
+		return strings.Contains(label, "#") && slices.Contains(types, typeOf(label))
+	}
+
+	return g.Subgraph(func(l *dotLine) bool {
+		return isRelationOfTypes(g.relationOf(l.From())) || isRelationOfTypes(g.relationOf(l.To()))
+	})
+}
+
+// relationsSubgraph returns a new graph containing only the given relation
+// nodes, their immediate neighbors, and the edges between them and their
+// neighbors.
+func relationsSubgraph(g *dotEncodingGraph, relations []string) (*dotEncodingGraph, error) {
+	focus := map[string]bool{}
+	for _, relation := range relations {
+		if _, _, ok := strings.Cut(relation, "#"); !ok {
+			return nil, fmt.Errorf("invalid relation %q: expected type#relation", relation)
+		}
+
+		id, ok := g.mapping[relation]
+		if !ok || g.Node(id) == nil {
+			return nil, fmt.Errorf("relation %s not found in the model", relation)
+		}
+		focus[relation] = true
+	}
+
+	return g.Subgraph(func(l *dotLine) bool {
+		return focus[g.relationOf(l.From())] || focus[g.relationOf(l.To())]
+	}), nil
+}
+
+// generationHeader returns the comment lines prepended to the output when a
+// header is requested.
+func generationHeader(model *openfgav1.AuthorizationModel, timestamp bool) (string, error) {
+	bytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(model)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash model: %w", err)
+	}
+
+	var header strings.Builder
+	header.WriteString("// generated by openfga-graphviz-gen\n")
+	if timestamp {
+		fmt.Fprintf(&header, "// generated at %s\n", time.Now().UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(&header, "// model sha256: %x\n", sha256.Sum256(bytes))
+	return header.String(), nil
+}
+
+// parseGraphAttributes parses graphviz graph attributes given as key=value.
+func parseGraphAttributes(attrs []string) ([]encoding.Attribute, error) {
+	parsed := make([]encoding.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		key, value, ok := strings.Cut(attr, "=")
+		if !ok || strings.TrimSpace(key) == "" || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid graph attribute %q: expected key=value", attr)
+		}
+		parsed = append(parsed, encoding.Attribute{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
+	}
+	return parsed, nil
+}
+
+// rankKeywords are the graphviz ranks the nodes of a type can be pinned to.
+// "same" keeps the nodes of the type on one rank, "min" and "source" put them
+// on the first rank, at the bottom with the default rankdir=BT, and "max" and
+// "sink" on the last one, at the top. "source" and "sink" keep the rank to
+// the type alone.
+var rankKeywords = []string{"same", "min", "max", "source", "sink"}
+
+// parseTypeRanks parses type ranks given as type=rank, e.g. user=source.
+func parseTypeRanks(ranks []string) ([]typeRank, error) {
+	parsed := make([]typeRank, 0, len(ranks))
+	for _, r := range ranks {
+		typeName, rank, ok := strings.Cut(r, "=")
+		typeName, rank = strings.TrimSpace(typeName), strings.TrimSpace(rank)
+		if !ok || typeName == "" || rank == "" {
+			return nil, fmt.Errorf("invalid type rank %q: expected type=rank", r)
+		}
+		if !slices.Contains(rankKeywords, rank) {
+			return nil, fmt.Errorf("unsupported rank %q for type %s: expected same, min, max, source or sink", rank, typeName)
+		}
+		parsed = append(parsed, typeRank{typeName: typeName, rank: rank})
+	}
+	return parsed, nil
+}
+
+// sizePattern matches a graphviz size: a width and an optional height in
+// inches, optionally followed by "!" to scale the graph up to the size.
+var sizePattern = regexp.MustCompile(`^\d+(\.\d+)?(,\d+(\.\d+)?)?!?$`)
+
+// graphAttributes returns the graph attributes requested by the options:
+// the resolution and the size of the rendered image, followed by the extra
+// graph attributes, which override them.
+func graphAttributes(o *options) ([]encoding.Attribute, error) {
+	var attrs []encoding.Attribute
+	if o.theme != "" {
+		t, ok := themes[o.theme]
+		if !ok {
+			return nil, fmt.Errorf("unsupported theme %q: expected light or dark", o.theme)
+		}
+		attrs = append(attrs, t.graph...)
+	}
+	if o.dpi < 0 {
+		return nil, fmt.Errorf("invalid dpi %v: expected a positive number", o.dpi)
+	}
+	if o.dpi > 0 {
+		attrs = append(attrs, encoding.Attribute{Key: "dpi", Value: strconv.FormatFloat(o.dpi, 'f', -1, 64)})
+	}
+	if o.size != "" {
+		if !sizePattern.MatchString(o.size) {
+			return nil, fmt.Errorf("invalid size %q: expected width[,height] in inches, e.g. 7.5,10", o.size)
+		}
+		attrs = append(attrs, encoding.Attribute{Key: "size", Value: o.size})
+	}
+
+	graphAttrs, err := parseGraphAttributes(o.graphAttrs)
+	if err != nil {
+		return nil, err
+	}
+	return append(attrs, graphAttrs...), nil
+}
+
+// modelTitle describes which model a graph was generated from.
+func modelTitle(model *openfgav1.AuthorizationModel) string {
+	if model.GetId() == "" {
+		return fmt.Sprintf("schema %s", model.GetSchemaVersion())
+	}
+	return fmt.Sprintf("model %s (schema %s)", model.GetId(), model.GetSchemaVersion())
+}
+
+// conditionSignatures returns the parameters of every condition of the model
+// as they are declared in the DSL, sorted by name, e.g. "(x: int, y: string)"
+// for condition1, by condition name.
+func conditionSignatures(model *openfgav1.AuthorizationModel) map[string]string {
+	signatures := map[string]string{}
+	for name, condition := range model.GetConditions() {
+		names := make([]string, 0, len(condition.GetParameters()))
+		for param := range condition.GetParameters() {
+			names = append(names, param)
+		}
+		sort.Strings(names)
+
+		params := make([]string, 0, len(names))
+		for _, param := range names {
+			params = append(params, fmt.Sprintf("%s: %s", param, conditionParamType(condition.GetParameters()[param])))
+		}
+		signatures[name] = "(" + strings.Join(params, ", ") + ")"
+	}
+	return signatures
+}
+
+// conditionParamType returns the DSL spelling of the type of a condition
+// parameter, e.g. int or map<string>.
+func conditionParamType(ref *openfgav1.ConditionParamTypeRef) string {
+	typeName := strings.ToLower(strings.TrimPrefix(ref.GetTypeName().String(), "TYPE_NAME_"))
+	if len(ref.GetGenericTypes()) == 0 {
+		return typeName
+	}
+
+	generics := make([]string, 0, len(ref.GetGenericTypes()))
+	for _, generic := range ref.GetGenericTypes() {
+		generics = append(generics, conditionParamType(generic))
+	}
+	return fmt.Sprintf("%s<%s>", typeName, strings.Join(generics, ", "))
+}
+
 // Writer returns the DOT of the model and information about cycles in the model
-func Writer(modelString string) (string, *CycleInformation) {
-	model := parser.MustTransformDSLToProto(modelString)
+func Writer(modelString string, opts ...Option) (string, *CycleInformation, error) {
+	var result strings.Builder
+	cycleInfo, err := WriteTo(&result, modelString, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	return result.String(), cycleInfo, nil
+}
 
-	g := buildGraph(model)
+// WriterFromModel is like Writer, but takes an already parsed model, such as
+// one combined from several module files.
+func WriterFromModel(model *openfgav1.AuthorizationModel, opts ...Option) (string, *CycleInformation, error) {
+	var result strings.Builder
+	cycleInfo, err := WriteModelTo(&result, model, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+	return result.String(), cycleInfo, nil
+}
+
+// WriteTo is like Writer, but writes the DOT of the model to w as it is
+// encoded, node by node and edge by edge, instead of returning it whole.
+// Everything that can fail other than writing to w is done before the first
+// write, so nothing is written if the model can't be rendered.
+func WriteTo(w io.Writer, modelString string, opts ...Option) (*CycleInformation, error) {
+	model, err := parseModel(modelString)
+	if err != nil {
+		return nil, err
+	}
 
-	g.RemoveNodesWithNoEdges()
+	return WriteModelTo(w, model, opts...)
+}
 
-	multi, err := dot.MarshalMulti(g, "", "", "")
+// Cycles returns the information found about the cycles of the model, along
+// with its warnings and metrics, as Writer does, but without rendering its
+// graph, e.g. for tools that only validate models.
+func Cycles(modelString string, opts ...Option) (*CycleInformation, error) {
+	model, err := parseModel(modelString)
 	if err != nil {
-		log.Fatalf("failed to render graph: %v", err)
+		return nil, err
+	}
+
+	return CyclesFromModel(model, opts...), nil
+}
+
+// CyclesFromModel is like Cycles, but takes an already parsed model.
+func CyclesFromModel(model *openfgav1.AuthorizationModel, opts ...Option) *CycleInformation {
+	_, cycleInfo := analyzeModel(model, newOptions(opts...))
+	return cycleInfo
+}
+
+// analyzeModel builds the graph of the model without its nodes that have no
+// edges, unless isolated nodes are kept, and returns it along with the
+// cycles, warnings and metrics of the model. It is the part of rendering
+// shared by WriteModelTo and Cycles.
+func analyzeModel(model *openfgav1.AuthorizationModel, o *options) (*dotEncodingGraph, *CycleInformation) {
+	g, warnings := buildGraph(model, o)
+	removed := g.NodesWithNoEdges()
+	if o.keepIsolated {
+		// every type gets a wildcard node whether or not it can be assigned
+		// as a wildcard, so the unused ones aren't part of the model
+		g.RemoveNodes(slices.DeleteFunc(slices.Clone(removed), func(label string) bool {
+			return !strings.HasSuffix(label, ":*")
+		}))
+	} else {
+		g.RemoveNodes(removed)
+	}
+
+	relationGraph := g.RelationGraph()
+	pathsInCycles := topo.DirectedCyclesIn(relationGraph)
+	cycleInfo := parseCycleInformation(relationGraph, pathsInCycles)
+	cycleInfo.warnings = warnings
+	cycleInfo.metrics = computeMetrics(model, relationGraph)
+
+	for _, label := range removed {
+		if strings.Contains(label, "#") {
+			cycleInfo.isolatedRelations = append(cycleInfo.isolatedRelations, label)
+			cycleInfo.warnings = append(cycleInfo.warnings, fmt.Sprintf("relation %s is isolated: nothing references it and it references nothing", label))
+		}
+	}
+
+	if o.selfUsersetNotices {
+		cycleInfo.notices = selfUsersetNotices(model)
+	}
+
+	return g, cycleInfo
+}
+
+// selfUsersetNotices returns a notice for every relation that is assignable
+// to its own userset, e.g. "define viewer: [document#viewer]" on document,
+// sorted. It's a common way to nest objects, e.g. groups of groups, but
+// sometimes a mistake. Such an edge is a loop of the relation, which isn't
+// reported as a cycle.
+func selfUsersetNotices(model *openfgav1.AuthorizationModel) []string {
+	var notices []string
+	for _, typedef := range model.GetTypeDefinitions() {
+		for relation, metadata := range typedef.GetMetadata().GetRelations() {
+			if slices.ContainsFunc(metadata.GetDirectlyRelatedUserTypes(), func(relatedType *openfgav1.RelationReference) bool {
+				return relatedType.GetType() == typedef.GetType() && relatedType.GetRelation() == relation
+			}) {
+				notices = append(notices, fmt.Sprintf("relation %s#%s is assignable to its own userset, so it is granted recursively", typedef.GetType(), relation))
+			}
+		}
+	}
+	sort.Strings(notices)
+	return notices
+}
+
+// WriteModelTo is like WriteTo, but takes an already parsed model.
+func WriteModelTo(w io.Writer, model *openfgav1.AuthorizationModel, opts ...Option) (*CycleInformation, error) {
+	header, write, cycleInfo, err := renderModel(model, newOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.WriteString(w, header); err != nil {
+		return nil, fmt.Errorf("failed to write graph: %w", err)
+	}
+	if err := write(w); err != nil {
+		return nil, fmt.Errorf("failed to write graph: %w", err)
+	}
+
+	return cycleInfo, nil
+}
+
+// renderModel builds the graph of the model and returns the header comments
+// to write before it, if any, a function writing the graph in the output
+// format, and the information about the cycles of the model. Everything that
+// can fail, other than writing, is done here, before anything is written.
+func renderModel(model *openfgav1.AuthorizationModel, o *options) (string, func(w io.Writer) error, *CycleInformation, error) {
+	switch o.format {
+	case formatDOT:
+	case formatDOTClusterByRewrite:
+		o.operatorNodes = true
+	case formatGraphML:
+	case formatCSV:
+	case formatMatrix:
+	default:
+		return "", nil, nil, fmt.Errorf("unsupported output format %q", o.format)
+	}
+
+	graphAttrs, err := graphAttributes(o)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	typeRanks, err := parseTypeRanks(o.typeRanks)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	for _, r := range typeRanks {
+		if !slices.ContainsFunc(model.GetTypeDefinitions(), func(typedef *openfgav1.TypeDefinition) bool {
+			return typedef.GetType() == r.typeName
+		}) {
+			return "", nil, nil, fmt.Errorf("type %s not found in the model", r.typeName)
+		}
+	}
+
+	g, cycleInfo := analyzeModel(model, o)
+	g.clusterRewrites = o.format == formatDOTClusterByRewrite
+
+	if len(o.hiddenUserTypes) > 0 || len(o.onlyUserTypes) > 0 {
+		g = userTypesSubgraph(g, o.hiddenUserTypes, o.onlyUserTypes)
+	}
+
+	if len(o.relations) > 0 {
+		var err error
+		g, err = relationsSubgraph(g, o.relations)
+		if err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	if len(o.types) > 0 {
+		g = typesSubgraph(g, o.types)
+	}
+
+	if o.cyclesOnly {
+		g = cycleSubgraph(g, cycleInfo.cycles)
+	}
+
+	if o.typeSummary {
+		g = g.TypeSummary()
+	}
+
+	truncation := ""
+	if o.maxNodes > 0 || o.maxEdges > 0 {
+		nodes, edges := g.Nodes().Len(), len(g.SortedLines())
+		g = g.Truncated(o.maxNodes, o.maxEdges)
+		if g.Nodes().Len() < nodes || len(g.SortedLines()) < edges {
+			truncation = fmt.Sprintf("graph truncated: showing %d of %d nodes and %d of %d edges", g.Nodes().Len(), nodes, len(g.SortedLines()), edges)
+			cycleInfo.warnings = append(cycleInfo.warnings, truncation)
+		}
+	}
+
+	var cycleColors []cycleColor
+	if o.highlight != "" {
+		if !strings.Contains(o.highlight, "#") {
+			return "", nil, nil, fmt.Errorf("invalid relation %q: expected type#relation", o.highlight)
+		}
+		if id, ok := g.mapping[o.highlight]; !ok || g.Node(id) == nil {
+			return "", nil, nil, fmt.Errorf("relation %s not found in the model", o.highlight)
+		}
+		highlighted := g.Highlight(o.highlight)
+		if o.numberedCycles {
+			// a cycle is highlighted as a whole, since each of its relations
+			// is derived from all the others
+			cycles := map[int][]string{}
+			for i, cycle := range cycleInfo.cycles {
+				if slices.Contains(highlighted, cycle[0]) {
+					cycles[i+1] = cycle
+				}
+			}
+			cycleColors = g.ColorCycles(cycles)
+		}
+	}
+
+	// closure sizes and the matrix are computed before edges are reversed or
+	// split into hops, while every edge still points to what it grants
+	if o.closureSizes {
+		g.LabelClosureSizes()
+	}
+	var matrixGraph *dotEncodingGraph
+	if o.format == formatMatrix {
+		matrixGraph = g.RelationGraph()
+	}
+
+	if o.tuplesetHops {
+		g = g.TuplesetHops()
+	}
+
+	if o.reverse {
+		g = g.Reversed()
+	}
+
+	if o.recordNodes {
+		g = g.RecordNodes()
+	}
+
+	if o.sortedEdges {
+		g = g.SortedByLabel()
+	}
+
+	g.NumberEdges()
+	if o.typeSummary && o.summaryCounts {
+		g.LabelCounts()
+	}
+	if o.weights {
+		g.LabelWeights()
+	}
+	if o.title {
+		g.title = modelTitle(model)
+	}
+	g.fontname = o.fontname
+	g.graphAttrs = graphAttrs
+	g.theme = themes[o.theme]
+	g.legend = o.legend
+	g.typeRanks = typeRanks
+	g.cycleColors = cycleColors
+	if o.wildcardLabel != "" {
+		g.LabelWildcards(o.wildcardLabel)
+	}
+	if o.tuplesetLabel != "" {
+		g.LabelTuplesets(o.tuplesetLabel)
+	}
+	if o.conditionParams {
+		g.LabelConditionSignatures(conditionSignatures(model))
+	}
+	if o.typeShapes {
+		g.ShapeNodes()
+	}
+	if o.labelIDs {
+		g.UseLabelIDs()
+	}
+	if o.htmlLabels {
+		g.UseHTMLLabels()
+	}
+
+	var write func(w io.Writer) error
+	switch o.format {
+	case formatGraphML:
+		write = g.WriteGraphML
+	case formatCSV:
+		// operator nodes only structure the drawing, the rows are the edges
+		// between relations
+		write = g.RelationGraph().WriteCSV
+	case formatMatrix:
+		write = matrixGraph.WriteMatrix
+	default:
+		write = func(w io.Writer) error {
+			return writeDOT(w, g)
+		}
+	}
+
+	header := ""
+	if o.header {
+		header, err = generationHeader(model, o.headerTimestamp)
+		if err != nil {
+			return "", nil, nil, err
+		}
+	}
+	if truncation != "" {
+		header += fmt.Sprintf("// %s\n", truncation)
+	}
+	switch o.format {
+	case formatGraphML:
+		header = graphMLHeader(header)
+	case formatCSV, formatMatrix:
+		// CSV has no comments, so that spreadsheets read every line as a row
+		header = ""
 	}
 
-	return string(multi), parseCycleInformation(g)
+	return header, write, cycleInfo, nil
 }
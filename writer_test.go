@@ -1,19 +1,28 @@
 package main
 
 import (
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/typesystem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph"
 )
 
 func TestWriter_DOT(t *testing.T) {
 	testCases := map[string]struct {
 		inputModel     string
+		opts           []Option
 		expectedOutput string
 	}{
 		`with_union`: { // https://github.com/openfga/openfga/blob/main/docs/list_objects/example/example.md
@@ -46,26 +55,34 @@ rankdir=BT
 4 [label="document#parent"];
 5 [label=folder];
 6 [label="document#viewer"];
-7 [label="user:*"];
-8 [label="group#member"];
-9 [label="folder#viewer"];
+7 [
+label=or
+shape=diamond
+];
+8 [label="user:*"];
+9 [label="group#member"];
+10 [label="folder#viewer"];
 
 // Edge definitions.
-2 -> 6 [
-label=6
+2 -> 7 [
+label=7
 style=dashed
 ];
 3 -> 2 [label=1];
-3 -> 6 [label=3];
-3 -> 8 [label=9];
-3 -> 9 [label=8];
+3 -> 7 [label=4];
+3 -> 9 [label=10];
+3 -> 10 [label=9];
 5 -> 4 [label=2];
-7 -> 6 [label=4];
-8 -> 6 [label=5];
-8 -> 8 [label=10];
-9 -> 6 [
-label=7
-headlabel="(document#parent)"
+7 -> 6 [label=3];
+8 -> 7 [label=5];
+9 -> 7 [label=6];
+9 -> 9 [
+color=blue
+label=11
+];
+10 -> 7 [
+headlabel="(viewer from document#parent)"
+label=8
 ];
 }`,
 		},
@@ -132,9 +149,242 @@ style=dashed
 3 -> 2 [label=1];
 3 -> 4 [label=2];
 4 -> 5 [
+arrowhead=tee
+label=4
+style=dashed
+];
+}`,
+		},
+		`with_exclusion_of_tuple_to_userset`: {
+			inputModel: `
+				model
+					schema 1.1
+				type user
+				type folder
+				   relations
+					 define viewer: [user]
+				type document
+				   relations
+					 define parent: [folder]
+					 define blocked: [user]
+					 define viewer: viewer from parent but not blocked`,
+			expectedOutput: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#blocked"];
+3 [label=user];
+4 [label="document#parent"];
+5 [label=folder];
+6 [label="document#viewer"];
+7 [label="folder#viewer"];
+
+// Edge definitions.
+2 -> 6 [
+arrowhead=tee
+label=4
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 7 [label=5];
+5 -> 4 [label=2];
+7 -> 6 [
+headlabel="(viewer from document#parent)"
+label=3
+];
+}`,
+		},
+		`with_exclusion_of_tuple_to_userset_operator_node`: {
+			inputModel: `
+				model
+					schema 1.1
+				type user
+				type folder
+				   relations
+					 define viewer: [user]
+				type document
+				   relations
+					 define parent: [folder]
+					 define blocked: [user]
+					 define viewer: viewer from parent but not blocked`,
+			opts: []Option{WithOperatorNodes()},
+			expectedOutput: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#blocked"];
+3 [label=user];
+4 [label="document#parent"];
+5 [label=folder];
+6 [label="document#viewer"];
+7 [
+label="but not"
+shape=diamond
+];
+8 [label="folder#viewer"];
+
+// Edge definitions.
+2 -> 7 [
+arrowhead=tee
+label=5
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 8 [label=6];
+5 -> 4 [label=2];
+7 -> 6 [label=3];
+8 -> 7 [
+headlabel="(viewer from document#parent)"
 label=4
+];
+}`,
+		},
+		`nested_union_in_intersection`: {
+			inputModel: `
+				model
+					schema 1.1
+				type user
+				type document
+				   relations
+					 define a: [user]
+					 define b: [user]
+					 define c: [user]
+					 define d: (a or b) and c`,
+			expectedOutput: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#a"];
+3 [label=user];
+4 [label="document#b"];
+5 [label="document#c"];
+6 [label="document#d"];
+7 [
+label=or
+shape=diamond
+];
+
+// Edge definitions.
+2 -> 7 [
+label=5
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 4 [label=2];
+3 -> 5 [label=3];
+4 -> 7 [
+label=6
+style=dashed
+];
+5 -> 6 [
+label=7
+style=dashed
+];
+7 -> 6 [label=4];
+}`,
+		},
+		`nested_intersection_in_union`: {
+			inputModel: `
+				model
+					schema 1.1
+				type user
+				type document
+				   relations
+					 define a: [user]
+					 define b: [user]
+					 define c: [user]
+					 define d: (a and b) or c`,
+			expectedOutput: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#a"];
+3 [label=user];
+4 [label="document#b"];
+5 [label="document#c"];
+6 [label="document#d"];
+7 [
+label=or
+shape=diamond
+];
+8 [
+label=and
+shape=diamond
+];
+
+// Edge definitions.
+2 -> 8 [
+label=6
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 4 [label=2];
+3 -> 5 [label=3];
+4 -> 8 [
+label=7
+style=dashed
+];
+5 -> 7 [
+label=8
+style=dashed
+];
+7 -> 6 [label=4];
+8 -> 7 [label=5];
+}`,
+		},
+		`nested_exclusion_in_intersection`: {
+			inputModel: `
+				model
+					schema 1.1
+				type user
+				type document
+				   relations
+					 define a: [user]
+					 define b: [user]
+					 define c: [user]
+					 define d: (a but not b) and c`,
+			expectedOutput: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#a"];
+3 [label=user];
+4 [label="document#b"];
+5 [label="document#c"];
+6 [label="document#d"];
+7 [
+label="but not"
+shape=diamond
+];
+
+// Edge definitions.
+2 -> 7 [
+label=5
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 4 [label=2];
+3 -> 5 [label=3];
+4 -> 7 [
+arrowhead=tee
+label=6
+style=dashed
+];
+5 -> 6 [
+label=7
 style=dashed
 ];
+7 -> 6 [label=4];
 }`,
 		},
 		`with_conditions`: {
@@ -168,11 +418,11 @@ rankdir=BT
 
 // Node definitions.
 2 [label="document#admin"];
-3 [label=" user[with condition1]"];
+3 [label="user[with condition1]"];
 4 [label="document#viewer"];
-5 [label=" user[with condition3]:*"];
+5 [label="user[with condition3]:*"];
 6 [label="document#writer"];
-7 [label=" user[with condition2]"];
+7 [label="user[with condition2]"];
 
 // Edge definitions.
 3 -> 2 [label=1];
@@ -180,85 +430,254 @@ rankdir=BT
 7 -> 6 [label=3];
 }`,
 		},
-		`multigraph`: {
+		`with_collapsed_conditions`: {
 			inputModel: `
-				model
-				  schema 1.1
-				
-				type user
-				
-				type state
-				  relations
-					define can_view: [user]
-				
-				type transition
-				  relations
-					define start: [state]
-					define end: [state]
-					define can_apply: [user] and can_view from start and can_view from end`,
+			model
+				schema 1.1
+
+			type user
+
+			type document
+				relations
+					define admin: [user, user with condition1, user with condition2]
+					define viewer: [user:* with condition1]
+
+			condition condition1(x: int) {
+				x < 100
+			}
+
+			condition condition2(x: int) {
+				x < 100
+			}`,
+			opts: []Option{WithCollapsedConditions()},
 			expectedOutput: `digraph {
 graph [
 rankdir=BT
 ];
 
 // Node definitions.
-0 [label=state];
-2 [label="state#can_view"];
+2 [label="document#admin"];
 3 [label=user];
-6 [label="transition#can_apply"];
-7 [label="transition#end"];
-8 [label="transition#start"];
+4 [label="document#viewer"];
+5 [label="user:*"];
 
 // Edge definitions.
-0 -> 7 [label=5];
-0 -> 8 [label=6];
-2 -> 6 [
-label=3
-headlabel="(transition#start)"
-];
-2 -> 6 [
-label=4
-headlabel="(transition#end)"
-];
 3 -> 2 [label=1];
-3 -> 6 [label=2];
+3 -> 2 [label="2 [with condition1]"];
+3 -> 2 [label="3 [with condition2]"];
+5 -> 4 [label="4 [with condition1]"];
 }`,
 		},
-	}
+		`with_collapsed_conditions_on_usersets`: {
+			inputModel: `
+			model
+				schema 1.1
 
-	for name, test := range testCases {
-		t.Run(name, func(t *testing.T) {
-			actualDOT, _ := Writer(test.inputModel)
-			actualSorted := getSorted(actualDOT)
-			expectedSorted := getSorted(test.expectedOutput)
-			diff := cmp.Diff(expectedSorted, actualSorted)
+			type user
 
-			require.Empty(t, diff, "expectedDefinitiveCycle %s, got %s", test.expectedOutput, actualDOT)
-		})
-	}
-}
+			type group
+				relations
+					define member: [user]
 
-func TestWriter_Cycles(t *testing.T) {
-	testCases := map[string]struct {
-		model                    string
-		expectedPossibleCycles   int
-		expectedDefinitiveCycles int
-	}{
-		`computed_userset_1_definitive_cycle`: {
-			model: `
-				model
-					schema 1.1
-				type resource
-					relations
-						define a: b
-						define b: a`,
-			expectedDefinitiveCycles: 1,
-		},
-		`computed_userset_2`: {
-			model: `
-				model
-					schema 1.1
-				type resource
+			type folder
+				relations
+					define viewer: [user]
+
+			type document
+				relations
+					define parent: [folder, folder with condition1]
+					define viewer: [user, user with condition1, group#member with condition1] or viewer from parent
+
+			condition condition1(x: int) {
+				x < 100
+			}`,
+			opts: []Option{WithCollapsedConditions()},
+			expectedOutput: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#parent"];
+3 [label=folder];
+4 [label="document#viewer"];
+5 [
+label=or
+shape=diamond
+];
+6 [label=user];
+7 [label="group#member"];
+8 [label="folder#viewer"];
+
+// Edge definitions.
+3 -> 2 [label=1];
+3 -> 2 [label="2 [with condition1]"];
+5 -> 4 [label=3];
+6 -> 5 [label=4];
+6 -> 5 [label="5 [with condition1]"];
+6 -> 7 [label=10];
+6 -> 8 [label=9];
+7 -> 5 [label="6 [with condition1]"];
+8 -> 5 [
+headlabel="(viewer from document#parent)"
+label=7
+];
+8 -> 5 [
+headlabel="(viewer from document#parent)"
+label="8 [with condition1]"
+];
+}`,
+		},
+		`with_tooltips`: {
+			inputModel: `
+				model
+					schema 1.1
+				type user
+				type group
+				  relations
+					define member: [user with cond]
+				type document
+				  relations
+					define parent: [group]
+					define editor: [user]
+					define viewer: [user:*, group#member] or editor or member from parent
+				condition cond(x: int) {
+					x < 100
+				}`,
+			opts: []Option{WithTooltips()},
+			expectedOutput: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#editor"];
+3 [label=user];
+4 [label="document#parent"];
+5 [label=group];
+6 [label="document#viewer"];
+7 [
+shape=diamond
+label=or
+];
+8 [label="user:*"];
+9 [label="group#member"];
+11 [label="user[with cond]"];
+
+// Edge definitions.
+2 -> 7 [
+style=dashed
+tooltip="computed userset: editor"
+label=6
+];
+3 -> 2 [
+tooltip="direct assignment: user"
+label=1
+];
+5 -> 4 [
+tooltip="direct assignment: group"
+label=2
+];
+7 -> 6 [label=3];
+8 -> 7 [
+label=4
+tooltip="direct assignment: user:*"
+];
+9 -> 7 [
+tooltip="direct assignment: group#member"
+label=5
+];
+9 -> 7 [
+headlabel="(member from document#parent)"
+tooltip="tuple-to-userset: member from parent"
+label=7
+];
+11 -> 9 [
+tooltip="direct assignment: user with cond"
+label=8
+];
+}`,
+		},
+		`multigraph`: {
+			inputModel: `
+				model
+				  schema 1.1
+				
+				type user
+				
+				type state
+				  relations
+					define can_view: [user]
+				
+				type transition
+				  relations
+					define start: [state]
+					define end: [state]
+					define can_apply: [user] and can_view from start and can_view from end`,
+			expectedOutput: `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=state];
+2 [label="state#can_view"];
+3 [label=user];
+6 [label="transition#can_apply"];
+7 [label="transition#end"];
+8 [label="transition#start"];
+
+// Edge definitions.
+0 -> 7 [label=5];
+0 -> 8 [label=6];
+2 -> 6 [
+label=3
+headlabel="(can_view from transition#start)"
+];
+2 -> 6 [
+label=4
+headlabel="(can_view from transition#end)"
+];
+3 -> 2 [label=1];
+3 -> 6 [label=2];
+}`,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			actualDOT, _, err := Writer(test.inputModel, test.opts...)
+			require.NoError(t, err)
+			actualSorted := getSorted(actualDOT)
+			expectedSorted := getSorted(test.expectedOutput)
+			diff := cmp.Diff(expectedSorted, actualSorted)
+
+			require.Empty(t, diff, "expectedDefinitiveCycle %s, got %s", test.expectedOutput, actualDOT)
+		})
+	}
+}
+
+func TestWriter_Cycles(t *testing.T) {
+	testCases := map[string]struct {
+		model                    string
+		expectedPossibleCycles   int
+		expectedDefinitiveCycles int
+	}{
+		`computed_userset_1_definitive_cycle`: {
+			model: `
+				model
+					schema 1.1
+				type resource
+					relations
+						define a: b
+						define b: a`,
+			expectedDefinitiveCycles: 1,
+		},
+		`computed_userset_2`: {
+			model: `
+				model
+					schema 1.1
+				type resource
 					relations
 						define x: y
 						define y: z
@@ -405,18 +824,2843 @@ func TestWriter_Cycles(t *testing.T) {
 						define can_view: viewer1 or editor1`,
 			expectedPossibleCycles: 2,
 		},
+		`possible_cycle_with_several_direct_edges`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type resource
+					relations
+						define a: [user, resource#b]
+						define b: [user, resource#c]
+						define c: [user, resource#a]`,
+			expectedPossibleCycles: 1,
+		},
+		`possible_and_definitive_cycles`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type resource
+					relations
+						define a: b
+						define b: a
+						define c: [user, resource#d]
+						define d: [user, resource#e] or c
+						define e: d`,
+			expectedPossibleCycles:   2,
+			expectedDefinitiveCycles: 1,
+		},
 	}
 
 	for name, test := range testCases {
 		t.Run(name, func(t *testing.T) {
-			_, cycleInfo := Writer(test.model)
+			_, cycleInfo, err := Writer(test.model)
+			require.NoError(t, err)
 			assert.Equal(t, test.expectedPossibleCycles, cycleInfo.possibleCycles)
 			assert.Equal(t, test.expectedDefinitiveCycles, cycleInfo.definitiveCycles)
+			assert.Equal(t, len(cycleInfo.cycles), cycleInfo.possibleCycles+cycleInfo.definitiveCycles)
 			fmt.Println(cycleInfo.cycles)
 		})
 	}
 }
 
+func TestParseCycleInformation_ClosingEdge(t *testing.T) {
+	g := newDotEncodingGraph()
+	g.AddEdge("resource#a", "resource#b", computedEdge, "", "")
+	g.AddEdge("resource#b", "resource#c", computedEdge, "", "")
+	// the only edge that is not a computed userset closes the cycle
+	g.AddEdge("resource#c", "resource#a", directEdge, "", "")
+
+	node := func(label string) graph.Node {
+		return g.Node(g.mapping[label])
+	}
+	open := []graph.Node{node("resource#a"), node("resource#b"), node("resource#c")}
+	closed := append(open[:3:3], node("resource#a"))
+
+	for _, path := range [][]graph.Node{open, closed} {
+		cycleInfo := parseCycleInformation(g, [][]graph.Node{path})
+		assert.Equal(t, 1, cycleInfo.possibleCycles)
+		assert.Equal(t, 0, cycleInfo.definitiveCycles)
+		assert.Equal(t, [][]string{{"resource#a", "resource#b", "resource#c", "resource#a"}}, cycleInfo.cycles)
+		assert.Equal(t, []Cycle{{
+			Edges: []CycleEdge{
+				{From: "resource#a", To: "resource#b", Kind: "computed userset"},
+				{From: "resource#b", To: "resource#c", Kind: "computed userset"},
+				{From: "resource#c", To: "resource#a", Kind: "direct assignment"},
+			},
+			Definitive: false,
+		}}, cycleInfo.detailedCycles)
+	}
+
+	_, cycleInfo, err := Writer(`
+		model
+			schema 1.1
+		type resource
+			relations
+				define a: [resource#c]
+				define b: a
+				define c: b`)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cycleInfo.possibleCycles)
+	assert.Equal(t, 0, cycleInfo.definitiveCycles)
+}
+
+func TestWriter_DetailedCycles(t *testing.T) {
+	_, cycleInfo, err := Writer(`
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define editor: viewer
+				define viewer: [user, folder#editor]
+		type document
+			relations
+				define editor: viewer
+				define viewer: [user] or editor`)
+	require.NoError(t, err)
+
+	require.Len(t, cycleInfo.detailedCycles, len(cycleInfo.cycles))
+	for i, cycle := range cycleInfo.detailedCycles {
+		// the edges follow the flat cycle, node by node
+		labels := []string{cycle.Edges[0].From}
+		for _, edge := range cycle.Edges {
+			labels = append(labels, edge.To)
+		}
+		assert.Equal(t, cycleInfo.cycles[i], labels)
+	}
+
+	require.ElementsMatch(t, []Cycle{
+		{
+			Edges: []CycleEdge{
+				{From: "document#editor", To: "document#viewer", Kind: "computed userset"},
+				{From: "document#viewer", To: "document#editor", Kind: "computed userset"},
+			},
+			Definitive: true,
+		},
+		{
+			Edges: []CycleEdge{
+				{From: "folder#editor", To: "folder#viewer", Kind: "direct assignment"},
+				{From: "folder#viewer", To: "folder#editor", Kind: "computed userset"},
+			},
+			Definitive: false,
+		},
+	}, cycleInfo.detailedCycles)
+	assert.Equal(t, 1, cycleInfo.definitiveCycles)
+	assert.Equal(t, 1, cycleInfo.possibleCycles)
+}
+
+func TestWriter_CycleOperators(t *testing.T) {
+	testCases := map[string]struct {
+		model             string
+		expectedOperators []string
+	}{
+		// the models of intersection_and_union and exclusion_and_union above
+		`intersection_and_union`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type resource
+					relations
+						define x: [user] and y
+						define y: [user] and z
+						define z: [user] or x`,
+			expectedOperators: []string{"and"},
+		},
+		`exclusion_and_union`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type resource
+					relations
+						define x: [user] but not y
+						define y: [user] but not z
+						define z: [user] or x`,
+			expectedOperators: []string{"but not"},
+		},
+		`nested_in_union`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type resource
+					relations
+						define x: [user] or (y and z)
+						define y: [user] but not x
+						define z: [user]`,
+			expectedOperators: []string{"and", "but not"},
+		},
+		`union_only`: {
+			model: `
+				model
+					schema 1.1
+				type user
+				type resource
+					relations
+						define x: [user] or y
+						define y: [user] or x`,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// drawing the operators as nodes doesn't change what the cycles
+			// pass through
+			for _, opts := range [][]Option{nil, {WithOperatorNodes()}} {
+				_, cycleInfo, err := Writer(test.model, opts...)
+				require.NoError(t, err)
+				require.Len(t, cycleInfo.detailedCycles, 1)
+				assert.Equal(t, test.expectedOperators, cycleInfo.detailedCycles[0].Operators)
+			}
+		})
+	}
+}
+
+func TestCycles(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define editor: viewer
+				define viewer: [user, folder#editor]
+		type document
+			relations
+				define owner: [user]
+				define editor: viewer
+				define viewer: [user] or editor`
+
+	cycleInfo, err := Cycles(model)
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, [][]string{
+		{"document#editor", "document#viewer", "document#editor"},
+		{"folder#editor", "folder#viewer", "folder#editor"},
+	}, cycleInfo.cycles)
+	require.Equal(t, [][]string{{"document#editor", "document#viewer", "document#editor"}}, cycleInfo.definitiveCyclePaths)
+	require.Equal(t, 1, cycleInfo.definitiveCycles)
+	require.Equal(t, 1, cycleInfo.possibleCycles)
+	require.Empty(t, cycleInfo.isolatedRelations)
+
+	// the same information as when rendering the graph
+	_, rendered, err := Writer(model)
+	require.NoError(t, err)
+	require.Equal(t, rendered, cycleInfo)
+}
+
+func TestCycles_IsolatedRelations(t *testing.T) {
+	cycleInfo, err := Cycles(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define owner: [user]
+				define parent: owner
+				define viewer: owner from parent`)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"document#viewer"}, cycleInfo.isolatedRelations)
+	require.Contains(t, cycleInfo.warnings, "relation document#viewer is isolated: nothing references it and it references nothing")
+	require.Zero(t, cycleInfo.definitiveCycles+cycleInfo.possibleCycles)
+}
+
+func TestCycles_ComputedEdgeKinds(t *testing.T) {
+	// the edges of the cycle are dashed computed usersets, found by the
+	// lines the cycle passes through
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define a: b
+				define b: [user] or a`
+
+	actualDOT, cycleInfo, err := Writer(model)
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, `2 -> 4 [
+label=4
+style=dashed
+];`)
+	require.Contains(t, actualDOT, `3 -> 2 [
+label=1
+style=dashed
+];`)
+	require.Equal(t, []Cycle{{
+		Edges: []CycleEdge{
+			{From: "document#a", To: "document#b", Kind: "computed userset"},
+			{From: "document#b", To: "document#a", Kind: "computed userset"},
+		},
+		Definitive: true,
+	}}, cycleInfo.detailedCycles)
+	require.Equal(t, 1, cycleInfo.definitiveCycles)
+	require.Zero(t, cycleInfo.possibleCycles)
+
+	// a direct assignment in the cycle makes it possible only
+	model = `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define a: [document#b] or b
+				define b: a`
+
+	cycleInfo, err = Cycles(model)
+	require.NoError(t, err)
+	require.Equal(t, []Cycle{{
+		Edges: []CycleEdge{
+			{From: "document#a", To: "document#b", Kind: "computed userset"},
+			{From: "document#b", To: "document#a", Kind: "direct assignment"},
+		},
+	}}, cycleInfo.detailedCycles)
+	require.Zero(t, cycleInfo.definitiveCycles)
+	require.Equal(t, 1, cycleInfo.possibleCycles)
+}
+
+func TestWriter_KeepIsolated(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type organization
+		type document
+			relations
+				define owner: [user]
+				define parent: owner
+				define viewer: owner from parent`
+
+	actualDOT, _, err := Writer(model)
+	require.NoError(t, err)
+	require.NotContains(t, actualDOT, "organization")
+
+	actualDOT, cycleInfo, err := Writer(model, WithKeepIsolated())
+	require.NoError(t, err)
+	// every declared type survives, along with the isolated relation, but
+	// not the wildcard nodes of types that aren't assignable as wildcards
+	require.Equal(t, `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=document];
+2 [label="document#owner"];
+3 [label=user];
+4 [label="document#parent"];
+5 [label="document#viewer"];
+6 [label=organization];
+
+// Edge definitions.
+2 -> 4 [
+label=2
+style=dashed
+];
+3 -> 2 [label=1];
+}`, actualDOT)
+	require.Equal(t, []string{"document#viewer"}, cycleInfo.isolatedRelations)
+}
+
+func TestWriter_KeepIsolatedWithTransforms(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type orphan
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: viewer from parent`
+
+	for name, opts := range map[string][]Option{
+		"tupleset_hops": {WithTuplesetHops()},
+		"max_edges":     {WithMaxEdges(100)},
+		"max_nodes":     {WithMaxNodes(100)},
+		"type_summary":  {WithTypeSummary()},
+		"record_nodes":  {WithRecordNodes()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actualDOT, cycleInfo, err := Writer(model, append(opts, WithKeepIsolated())...)
+			require.NoError(t, err)
+			require.Contains(t, actualDOT, "[label=orphan];")
+			// kept isolated nodes aren't truncated when the limits aren't hit
+			require.Empty(t, cycleInfo.warnings)
+		})
+	}
+
+	// nodes without edges are truncated like the others once the limit is
+	// hit, after the nodes of the edges
+	actualDOT, cycleInfo, err := Writer(model, WithKeepIsolated(), WithMaxNodes(5))
+	require.NoError(t, err)
+	require.NotContains(t, actualDOT, "orphan")
+	require.Equal(t, []string{"graph truncated: showing 5 of 7 nodes and 3 of 3 edges"}, cycleInfo.warnings)
+}
+
+func TestCycles_ParseError(t *testing.T) {
+	_, err := Cycles(`model`)
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+}
+
+func TestParseCycleInformation_DeduplicatesRotations(t *testing.T) {
+	g := newDotEncodingGraph()
+	g.AddEdge("resource#a", "resource#b", computedEdge, "", "")
+	g.AddEdge("resource#b", "resource#c", computedEdge, "", "")
+	g.AddEdge("resource#c", "resource#a", computedEdge, "", "")
+
+	node := func(label string) graph.Node {
+		return g.Node(g.mapping[label])
+	}
+	a, b, c := node("resource#a"), node("resource#b"), node("resource#c")
+
+	cycleInfo := parseCycleInformation(g, [][]graph.Node{
+		{b, c, a, b},
+		{a, b, c, a},
+		{c, a, b, c},
+	})
+	assert.Equal(t, 1, cycleInfo.definitiveCycles)
+	assert.Equal(t, 0, cycleInfo.possibleCycles)
+	assert.Equal(t, [][]string{{"resource#a", "resource#b", "resource#c", "resource#a"}}, cycleInfo.cycles)
+}
+
+func TestWriter_ParseError(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer [user]`
+
+	_, _, err := Writer(model)
+	require.Error(t, err)
+
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	assert.Contains(t, err.Error(), "line=7")
+}
+
+func TestWriter_IsolatedRelations(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define owner: [user]
+				define parent: owner
+				define viewer: owner from parent`
+
+	_, cycleInfo, err := Writer(model)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"document#viewer"}, cycleInfo.isolatedRelations)
+	require.Len(t, cycleInfo.warnings, 2)
+	assert.Contains(t, cycleInfo.warnings[0], "unsatisfiable")
+	assert.Contains(t, cycleInfo.warnings[1], "document#viewer is isolated")
+}
+
+func TestWriter_CyclesOnly(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type resource
+			relations
+				define a: b
+				define b: a
+				define c: [user]`
+
+	actualDOT, _, err := Writer(model, WithCyclesOnly())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label="resource#b"];
+1 [label="resource#a"];
+
+// Edge definitions.
+0 -> 1 [
+label=1
+style=dashed
+];
+1 -> 0 [
+label=2
+style=dashed
+];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)))
+}
+
+func TestWriter_EdgeLabelsAreConsecutive(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user]
+				define viewer: [user, user:*, group#member] or editor or viewer from parent
+		type resource
+			relations
+				define a: [user] or b
+				define b: [user] or a`
+
+	for _, opts := range [][]Option{nil, {WithCyclesOnly()}} {
+		actualDOT, _, err := Writer(model, opts...)
+		require.NoError(t, err)
+
+		_, edgeDefinitions, found := strings.Cut(actualDOT, "// Edge definitions.")
+		require.True(t, found)
+
+		var labels []int
+		for _, match := range regexp.MustCompile(`label=(\d+)`).FindAllStringSubmatch(edgeDefinitions, -1) {
+			label, err := strconv.Atoi(match[1])
+			require.NoError(t, err)
+			labels = append(labels, label)
+		}
+		sort.Ints(labels)
+
+		for i, label := range labels {
+			require.Equal(t, i+1, label)
+		}
+	}
+}
+
+func TestWriter_UndefinedConditions(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user with condition1, user with missing]
+				define editor: [user:* with missing]
+				define parent: [document with condition1]
+				define owner: owner from parent
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	_, cycleInfo, err := Writer(model)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"relation document#editor references undefined condition missing",
+		"relation document#viewer references undefined condition missing",
+	}, cycleInfo.warnings)
+}
+
+func TestWriter_UnassignableTupleset(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define owner: [folder]
+				define parent: owner
+				define viewer: [user] or viewer from parent`
+
+	_, cycleInfo, err := Writer(model)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"relation document#viewer references viewer from parent, which is unsatisfiable: document#parent has no directly related user types",
+	}, cycleInfo.warnings)
+}
+
+func TestWriter_SelfDefinedRelations(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user]
+				define a: a
+				define b: b and editor
+				define c: c but not editor
+				define d: [user] or d
+				define e: editor but not e`
+
+	_, cycleInfo, err := Writer(model)
+	require.NoError(t, err)
+	// a relation referring to itself is a loop, which cycle detection doesn't
+	// report, and recursion with a base case, e.g. through a union, is fine
+	assert.Equal(t, []string{
+		"relation document#a is defined only in terms of itself, so it can never be granted",
+		"relation document#b is defined only in terms of itself, so it can never be granted",
+		"relation document#c is defined only in terms of itself, so it can never be granted",
+	}, cycleInfo.warnings)
+	assert.Zero(t, cycleInfo.definitiveCycles+cycleInfo.possibleCycles)
+}
+
+func TestWriter_SelfUsersetNotices(t *testing.T) {
+	// the model of union_6_no_cycles
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user]
+				define viewer: [document#viewer] or editor`
+
+	_, cycleInfo, err := Writer(model)
+	require.NoError(t, err)
+	assert.Empty(t, cycleInfo.notices)
+
+	_, cycleInfo, err = Writer(model, WithSelfUsersetNotices())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"relation document#viewer is assignable to its own userset, so it is granted recursively"}, cycleInfo.notices)
+	// it's a notice rather than a warning or a cycle
+	assert.Empty(t, cycleInfo.warnings)
+	assert.Zero(t, cycleInfo.definitiveCycles+cycleInfo.possibleCycles)
+
+	// usersets of other relations or types, and conditioned usersets of the
+	// relation itself
+	model = `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member with condition1]
+				define owner: [group#member]
+		type document
+			relations
+				define viewer: [group#member, group#owner]
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	_, cycleInfo, err = Writer(model, WithSelfUsersetNotices())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"relation group#member is assignable to its own userset, so it is granted recursively"}, cycleInfo.notices)
+}
+
+func TestWriter_WildcardEdgeDirection(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user:*, user:* with condition1]
+		type document
+			relations
+				define parent: [folder]
+				define blocked: [user:*]
+				define owner: [user:*] and viewer from parent
+				define editor: [user:*] but not blocked
+				define viewer: [user, user:* with condition1] or (owner and editor) or viewer from parent
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	parsed, err := parseModel(model)
+	require.NoError(t, err)
+
+	// the DSL only allows direct types at the top of a rewrite, but models
+	// written through the API can nest them, e.g. in a union in an intersection
+	nested, err := parseStoreExport([]byte(`[{
+		"schema_version": "1.1",
+		"type_definitions": [
+			{"type": "user"},
+			{
+				"type": "document",
+				"relations": {
+					"editor": {"this": {}},
+					"viewer": {"intersection": {"child": [
+						{"computedUserset": {"relation": "editor"}},
+						{"union": {"child": [{"this": {}}, {"computedUserset": {"relation": "editor"}}]}}
+					]}}
+				},
+				"metadata": {"relations": {
+					"editor": {"directly_related_user_types": [{"type": "user"}]},
+					"viewer": {"directly_related_user_types": [{"type": "user", "wildcard": {}}]}
+				}}
+			}
+		]
+	}]`), "")
+	require.NoError(t, err)
+
+	// wildcards are only ever granted, like concrete types, so no edge points
+	// to a wildcard node whatever the rewrite it's nested in; only --reverse
+	// flips them, along with every other edge
+	for name, opts := range map[string][]Option{
+		"default":              nil,
+		"operator nodes":       {WithOperatorNodes()},
+		"collapsed conditions": {WithCollapsedConditions()},
+		"without conditions":   {WithoutConditions()},
+		"tupleset hops":        {WithTuplesetHops()},
+		"record nodes":         {WithRecordNodes()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, m := range []*openfgav1.AuthorizationModel{parsed, nested} {
+				g, _ := buildGraph(m, newOptions(opts...))
+				g.RemoveNodesWithNoEdges()
+
+				var wildcardEdges int
+				for _, l := range g.SortedLines() {
+					from, to := g.reverseMapping[l.From().ID()], g.reverseMapping[l.To().ID()]
+					require.NotContains(t, to, ":*", g.describeLine(l))
+					if strings.Contains(from, ":*") {
+						wildcardEdges++
+					}
+				}
+				require.NotZero(t, wildcardEdges)
+			}
+		})
+	}
+}
+
+func TestWriter_DuplicateOperands(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user]
+				define owner: [user]
+				define viewer: editor or editor
+				define can_share: (editor and owner) or viewer from parent or (editor and owner) or viewer from parent
+				define can_delete: owner and owner and owner`
+
+	_, cycleInfo, err := Writer(model)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`relation document#can_delete has a duplicate operand owner in its "and" expression`,
+		`relation document#can_delete has a duplicate operand owner in its "and" expression`,
+		`relation document#can_share has a duplicate operand (editor and owner) in its "or" expression`,
+		`relation document#can_share has a duplicate operand viewer from parent in its "or" expression`,
+		`relation document#viewer has a duplicate operand editor in its "or" expression`,
+	}, cycleInfo.warnings)
+
+	// distinct operands are not reported
+	_, cycleInfo, err = Writer(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user]
+				define owner: [user]
+				define viewer: editor or owner`)
+	require.NoError(t, err)
+	assert.Empty(t, cycleInfo.warnings)
+}
+
+func TestWriter_ExclusionOperands(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define blocked: [user]
+				define muted: [user]
+				define viewer: [user] but not (blocked or muted)`
+
+	actualDOT, _, err := Writer(model, WithOperatorNodes())
+	require.NoError(t, err)
+
+	// only the edge from the subtracted union into the exclusion is marked,
+	// not the edge from the base or the edges into the union
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#blocked"];
+3 [label=user];
+4 [label="document#muted"];
+5 [label="document#viewer"];
+6 [
+label="but not"
+shape=diamond
+];
+7 [
+label=or
+shape=diamond
+];
+
+// Edge definitions.
+2 -> 7 [
+label=6
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 4 [label=2];
+3 -> 6 [label=4];
+4 -> 7 [
+label=7
+style=dashed
+];
+6 -> 5 [label=3];
+7 -> 6 [
+arrowhead=tee
+label=5
+];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	// "a but not b" and "b but not a" draw the same edges, but mark different
+	// ones as subtracted
+	aButNotB, _, err := Writer(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define a: [user]
+				define b: [user]
+				define c: a but not b`)
+	require.NoError(t, err)
+	bButNotA, _, err := Writer(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define a: [user]
+				define b: [user]
+				define c: b but not a`)
+	require.NoError(t, err)
+	subtracted := func(dot string) []string {
+		var edges []string
+		for _, match := range regexp.MustCompile(`(\d+ -> \d+) \[([^\]]*)\]`).FindAllStringSubmatch(dot, -1) {
+			if strings.Contains(match[2], "arrowhead=tee") {
+				edges = append(edges, match[1])
+			}
+		}
+		return edges
+	}
+	// 2 is document#a, 4 is document#b and 5 is document#c
+	require.Equal(t, []string{"4 -> 5"}, subtracted(aButNotB))
+	require.Equal(t, []string{"2 -> 5"}, subtracted(bButNotA))
+}
+
+func TestWriter_WildcardsAndUsersets(t *testing.T) {
+	// a reference is either to a userset or to a wildcard, there is no
+	// wildcard of a userset
+	_, _, err := Writer(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [group#member:*]`)
+	require.ErrorContains(t, err, "parse error")
+
+	// a public group is granted through the userset of a group that has a
+	// wildcard assigned, so user:* reaches document#viewer through
+	// group#member; the wildcard of the group type itself is a separate node
+	actualDOT, _, err := Writer(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*]
+		type document
+			relations
+				define viewer: [group:*, group#member]`)
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#viewer"];
+3 [label="group:*"];
+4 [label="group#member"];
+6 [label=user];
+7 [label="user:*"];
+
+// Edge definitions.
+3 -> 2 [label=1];
+4 -> 2 [label=2];
+6 -> 4 [label=3];
+7 -> 4 [label=4];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+}
+
+func TestWriter_ConditionedTypesShareNodes(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user with condition1, user:* with condition1]
+				define editor: [user with condition1]
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	actualDOT, _, err := Writer(model)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(actualDOT, `[label="user[with condition1]"]`), actualDOT)
+	require.Equal(t, 1, strings.Count(actualDOT, `[label="user[with condition1]:*"]`), actualDOT)
+	require.NotContains(t, actualDOT, `label=" `)
+}
+
+func TestWriter_ConditionedTupleset(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder, folder with condition1]
+				define editor: [group#member with condition1]
+				define viewer: viewer from parent
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	parsed, err := parseModel(model)
+	require.NoError(t, err)
+
+	edgesInto := func(g *dotEncodingGraph, to string) map[string]string {
+		edges := map[string]string{}
+		for _, l := range g.SortedLines() {
+			if g.reverseMapping[l.To().ID()] == to {
+				edges[g.reverseMapping[l.From().ID()]] = l.attrs["tooltip"]
+			}
+		}
+		return edges
+	}
+
+	// the relation rewritten through the conditioned tupleset is labeled like
+	// a conditioned userset in a direct assignment
+	g, _ := buildGraph(parsed, newOptions(WithTooltips()))
+	require.Equal(t, map[string]string{
+		"group[with condition1]#member": "direct assignment: group#member with condition1",
+	}, edgesInto(g, "document#editor"))
+	require.Equal(t, map[string]string{
+		"folder#viewer":                  "tuple-to-userset: viewer from parent",
+		"folder[with condition1]#viewer": "tuple-to-userset: viewer from parent with condition1",
+	}, edgesInto(g, "document#viewer"))
+
+	g, _ = buildGraph(parsed, newOptions(WithCollapsedConditions()))
+	var conditions []string
+	for _, l := range g.SortedLines() {
+		if g.reverseMapping[l.To().ID()] == "document#viewer" {
+			require.Equal(t, "folder#viewer", g.reverseMapping[l.From().ID()])
+			conditions = append(conditions, l.condition)
+		}
+	}
+	require.Equal(t, []string{"", "condition1"}, conditions)
+
+	g, _ = buildGraph(parsed, newOptions(WithoutConditions()))
+	require.Len(t, edgesInto(g, "document#viewer"), 1)
+	require.Contains(t, edgesInto(g, "document#viewer"), "folder#viewer")
+}
+
+func TestWriter_WithoutConditions(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder, folder with condition1]
+				define viewer: [user, user with condition1, user:* with condition1, group#member with condition1] or viewer from parent
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	actualDOT, _, err := Writer(model, WithoutConditions())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#parent"];
+3 [label=folder];
+4 [label="document#viewer"];
+5 [
+label=or
+shape=diamond
+];
+6 [label=user];
+7 [label="user:*"];
+8 [label="group#member"];
+9 [label="folder#viewer"];
+
+// Edge definitions.
+3 -> 2 [label=1];
+5 -> 4 [label=2];
+6 -> 5 [label=3];
+6 -> 8 [label=8];
+6 -> 9 [label=7];
+7 -> 5 [label=4];
+8 -> 5 [label=5];
+9 -> 5 [
+headlabel="(viewer from document#parent)"
+label=6
+];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	actualDOT, _, err = Writer(model, WithoutConditions(), WithInlineAssignable())
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, `label="document#parent\n[folder]"`)
+	require.Contains(t, actualDOT, `label="document#viewer\n[user, user:*, group#member]"`)
+}
+
+func TestWriter_Relations(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define owner: [user]
+				define editor: [user] or owner
+				define can_share: editor
+				define viewer: editor or viewer from parent`
+
+	actualDOT, _, err := Writer(model, WithRelations("document#editor"))
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label="document#editor"];
+1 [label="document#can_share"];
+2 [
+label=or
+shape=diamond
+];
+3 [label=user];
+4 [label="document#owner"];
+5 [
+label=or
+shape=diamond
+];
+6 [label="document#viewer"];
+
+// Edge definitions.
+0 -> 1 [
+label=1
+style=dashed
+];
+0 -> 5 [
+label=6
+style=dashed
+];
+2 -> 0 [label=2];
+3 -> 2 [label=3];
+4 -> 2 [
+label=4
+style=dashed
+];
+5 -> 6 [label=5];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	_, _, err = Writer(model, WithRelations("document#missing"))
+	require.ErrorContains(t, err, "relation document#missing not found")
+
+	_, _, err = Writer(model, WithRelations("document"))
+	require.ErrorContains(t, err, "expected type#relation")
+}
+
+func TestWriter_ClusterByRewrite(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define a: [user]
+				define b: [user]
+				define c: [user] or (a and b)`
+
+	actualDOT, _, err := Writer(model, WithOutputFormat(formatDOTClusterByRewrite))
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+subgraph cluster_0 {
+graph [
+label="document#c"
+];
+
+subgraph {
+graph [
+rank=same
+];
+
+// Node definitions.
+6 [
+label=or
+shape=diamond
+];
+}
+subgraph {
+graph [
+rank=same
+];
+
+// Node definitions.
+7 [
+label=and
+shape=diamond
+];
+}
+// Node definitions.
+5 [label="document#c"];
+}
+// Node definitions.
+2 [label="document#a"];
+3 [label=user];
+4 [label="document#b"];
+5 [label="document#c"];
+6 [
+label=or
+shape=diamond
+];
+7 [
+label=and
+shape=diamond
+];
+
+// Edge definitions.
+2 -> 7 [
+label=6
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 4 [label=2];
+3 -> 6 [label=4];
+4 -> 7 [
+label=7
+style=dashed
+];
+6 -> 5 [label=3];
+7 -> 6 [label=5];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	actualDOT, _, err = Writer(model, WithOperatorNodes())
+	require.NoError(t, err)
+	require.NotContains(t, actualDOT, "subgraph")
+	require.Contains(t, actualDOT, "shape=diamond")
+
+	_, _, err = Writer(model, WithOutputFormat("svg"))
+	require.ErrorContains(t, err, `unsupported output format "svg"`)
+}
+
+func TestWriter_Title(t *testing.T) {
+	model, err := parseModel(`
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`)
+	require.NoError(t, err)
+
+	actualDOT, _, err := WriterFromModel(model, WithTitle())
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, `label="schema 1.1"`)
+
+	model.Id = "01HVMMBCMGZNT3SED4Z17ECXCA"
+	actualDOT, _, err = WriterFromModel(model, WithTitle())
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, `label="model 01HVMMBCMGZNT3SED4Z17ECXCA (schema 1.1)"`)
+	require.Contains(t, actualDOT, "labelloc=t")
+
+	actualDOT, _, err = WriterFromModel(model)
+	require.NoError(t, err)
+	require.NotContains(t, actualDOT, "labelloc")
+}
+
+func TestWriter_Reverse(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: viewer from parent`
+
+	actualDOT, _, err := Writer(model)
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#parent"];
+3 [label=folder];
+4 [label="document#viewer"];
+5 [label="folder#viewer"];
+7 [label=user];
+
+// Edge definitions.
+3 -> 2 [label=1];
+5 -> 4 [
+headlabel="(viewer from document#parent)"
+label=2
+];
+7 -> 5 [label=3];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	actualDOT, _, err = Writer(model, WithReverse())
+	require.NoError(t, err)
+
+	expectedDOT = `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label="document#parent"];
+1 [label=folder];
+2 [label="document#viewer"];
+3 [label="folder#viewer"];
+4 [label=user];
+
+// Edge definitions.
+0 -> 1 [label=1];
+2 -> 3 [
+label=2
+taillabel="(viewer from document#parent)"
+];
+3 -> 4 [label=3];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+}
+
+func TestWriter_SelfReferences(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type folder
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent`
+
+	actualDOT, _, err := Writer(model)
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=folder];
+2 [label="folder#parent"];
+3 [label="folder#viewer"];
+4 [
+label=or
+shape=diamond
+];
+5 [label=user];
+8 [label="group#member"];
+
+// Edge definitions.
+0 -> 2 [label=1];
+3 -> 4 [
+color=blue
+headlabel="(viewer from folder#parent)"
+label=4
+];
+4 -> 3 [label=2];
+5 -> 4 [label=3];
+5 -> 8 [label=5];
+8 -> 8 [
+color=blue
+label=6
+];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+}
+
+func TestWriter_Header(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`
+
+	withoutTimestamp, _, err := Writer(model, WithHeader(false))
+	require.NoError(t, err)
+	require.Regexp(t, `^// generated by openfga-graphviz-gen\n// model sha256: [0-9a-f]{64}\ndigraph \{`, withoutTimestamp)
+
+	again, _, err := Writer(model, WithHeader(false))
+	require.NoError(t, err)
+	require.Equal(t, withoutTimestamp, again)
+
+	changed, _, err := Writer(model+"\n\t\ttype folder", WithHeader(false))
+	require.NoError(t, err)
+	require.NotEqual(t, strings.SplitN(withoutTimestamp, "\n", 3)[1], strings.SplitN(changed, "\n", 3)[1])
+
+	withTimestamp, _, err := Writer(model, WithHeader(true))
+	require.NoError(t, err)
+	require.Regexp(t, `^// generated by openfga-graphviz-gen\n// generated at \S+\n// model sha256: [0-9a-f]{64}\ndigraph \{`, withTimestamp)
+
+	withoutHeader, _, err := Writer(model)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(withoutHeader, "digraph {"))
+}
+
+func TestWriter_SchemaVersion1_0(t *testing.T) {
+	// schema 1.0 models can't be written in the DSL anymore, but they can
+	// still be read from a store.
+	model := &openfgav1.AuthorizationModel{
+		SchemaVersion: typesystem.SchemaVersion1_0,
+		TypeDefinitions: []*openfgav1.TypeDefinition{
+			{Type: "user"},
+			{
+				Type: "folder",
+				Relations: map[string]*openfgav1.Userset{
+					"viewer": typesystem.This(),
+				},
+			},
+			{
+				Type: "document",
+				Relations: map[string]*openfgav1.Userset{
+					"parent": typesystem.This(),
+					"editor": typesystem.This(),
+					"viewer": typesystem.Union(typesystem.ComputedUserset("editor"), typesystem.TupleToUserset("parent", "viewer")),
+				},
+			},
+		},
+	}
+
+	actualDOT, cycleInfo, err := WriterFromModel(model)
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#editor"];
+3 [label="any user"];
+4 [label="document#parent"];
+5 [label="document#viewer"];
+6 [
+label=or
+shape=diamond
+];
+7 [label="folder#viewer"];
+
+// Edge definitions.
+2 -> 6 [
+label=4
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 4 [label=2];
+3 -> 7 [label=7];
+5 -> 6 [
+color=blue
+headlabel="(viewer from document#parent)"
+label=5
+];
+6 -> 5 [label=3];
+7 -> 6 [
+headlabel="(viewer from document#parent)"
+label=6
+];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+	require.Equal(t, []string{`model uses schema 1.0: relations are untyped, direct assignments are drawn from "any user"`}, cycleInfo.warnings)
+}
+
+func TestWriter_Fontname(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`
+
+	actualDOT, _, err := Writer(model, WithFontname("Helvetica Neue"))
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+fontname="Helvetica Neue"
+];
+node [
+fontname="Helvetica Neue"
+];
+edge [
+fontname="Helvetica Neue"
+];
+
+// Node definitions.
+2 [label="document#viewer"];
+3 [label=user];
+
+// Edge definitions.
+3 -> 2 [label=1];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	actualDOT, _, err = Writer(model)
+	require.NoError(t, err)
+	require.NotContains(t, actualDOT, "fontname")
+}
+
+func TestWriter_Theme(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user] or viewer`
+
+	actualDOT, _, err := Writer(model, WithTheme("dark"), WithGraphAttributes("bgcolor=black"))
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+bgcolor=black
+fontcolor="#c9d1d9"
+];
+node [
+color="#8b949e"
+fillcolor="#161b22"
+fontcolor="#c9d1d9"
+style=filled
+];
+edge [
+color="#8b949e"
+fontcolor="#c9d1d9"
+];
+
+// Node definitions.
+2 [label="document#viewer"];
+3 [
+label=or
+shape=diamond
+];
+4 [label=user];
+
+// Edge definitions.
+2 -> 3 [
+color=blue
+label=3
+style=dashed
+];
+3 -> 2 [label=1];
+4 -> 3 [label=2];
+}`
+	// the graph attributes given override the theme, and so do the colors of
+	// individual edges
+	require.Equal(t, expectedDOT, actualDOT)
+
+	for name := range themes {
+		_, _, err := Writer(model, WithTheme(name))
+		require.NoError(t, err)
+	}
+
+	_, _, err = Writer(model, WithTheme("solarized"))
+	require.EqualError(t, err, `unsupported theme "solarized": expected light or dark`)
+
+	parsed, err := parseModel(model)
+	require.NoError(t, err)
+	expansion, err := ExpansionTree(parsed, "document#viewer", WithTheme("light"))
+	require.NoError(t, err)
+	require.Contains(t, expansion, `bgcolor="#ffffff"`)
+	require.Contains(t, expansion, `fillcolor="#f6f8fa"`)
+}
+
+func TestWriter_TypeShapes(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user:*]
+				define viewer: [user] or editor`
+
+	actualDOT, _, err := Writer(model, WithTypeShapes())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [
+label="document#editor"
+shape=ellipse
+];
+3 [
+label="user:*"
+shape=box
+];
+4 [
+label="document#viewer"
+shape=ellipse
+];
+5 [
+label=or
+shape=diamond
+];
+6 [
+label=user
+shape=box
+];
+
+// Edge definitions.
+2 -> 5 [
+label=4
+style=dashed
+];
+3 -> 2 [label=1];
+5 -> 4 [label=2];
+6 -> 5 [label=3];
+}`
+	// operator nodes keep their diamond shape
+	require.Equal(t, expectedDOT, actualDOT)
+
+	// record nodes keep their record shape
+	actualDOT, _, err = Writer(model, WithTypeShapes(), WithRecordNodes())
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, "shape=record")
+	require.NotContains(t, actualDOT, "shape=ellipse")
+}
+
+func TestWriter_LabelIDs(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user:*]
+				define viewer: editor`
+
+	actualDOT, _, err := Writer(model, WithLabelIDs())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+document_editor [label="document#editor"];
+user_wildcard [label="user:*"];
+document_viewer [label="document#viewer"];
+
+// Edge definitions.
+document_editor -> document_viewer [
+label=2
+style=dashed
+];
+user_wildcard -> document_editor [label=1];
+}`
+	require.Equal(t, expectedDOT, actualDOT)
+
+	// the IDs don't depend on the other types of the model
+	changedDOT, _, err := Writer(model+"\n\t\ttype folder\n\t\t\trelations\n\t\t\t\tdefine viewer: [user]", WithLabelIDs())
+	require.NoError(t, err)
+	require.Contains(t, changedDOT, "user_wildcard -> document_editor [label=1];")
+}
+
+func TestWriter_TypeRanks(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user, user:*]
+				define viewer: editor`
+
+	actualDOT, _, err := Writer(model, WithTypeRanks("user=source", "document=sink"))
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+subgraph {
+graph [
+rank=source
+];
+
+// Node definitions.
+3 [label=user];
+4 [label="user:*"];
+}
+subgraph {
+graph [
+rank=sink
+];
+
+// Node definitions.
+2 [label="document#editor"];
+5 [label="document#viewer"];
+}
+// Node definitions.
+2 [label="document#editor"];
+3 [label=user];
+4 [label="user:*"];
+5 [label="document#viewer"];
+
+// Edge definitions.
+2 -> 5 [
+label=3
+style=dashed
+];
+3 -> 2 [label=1];
+4 -> 2 [label=2];
+}`
+	require.Equal(t, expectedDOT, actualDOT)
+
+	_, _, err = Writer(model, WithTypeRanks("user"))
+	require.EqualError(t, err, `invalid type rank "user": expected type=rank`)
+
+	_, _, err = Writer(model, WithTypeRanks("user=top"))
+	require.EqualError(t, err, `unsupported rank "top" for type user: expected same, min, max, source or sink`)
+
+	_, _, err = Writer(model, WithTypeRanks("folder=sink"))
+	require.EqualError(t, err, "type folder not found in the model")
+}
+
+func TestWriter_UserTypeFilters(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type document
+			relations
+				define parent: [group]
+				define viewer: [user, group#member] or member from parent`
+
+	actualDOT, _, err := Writer(model, WithHiddenUserTypes("user"))
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=group];
+1 [label="document#parent"];
+2 [
+label=or
+shape=diamond
+];
+3 [label="document#viewer"];
+4 [label="group#member"];
+
+// Edge definitions.
+0 -> 1 [label=1];
+2 -> 3 [label=2];
+4 -> 2 [label=3];
+4 -> 2 [
+headlabel="(member from document#parent)"
+label=4
+];
+4 -> 4 [
+color=blue
+label=5
+];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	actualDOT, _, err = Writer(model, WithOnlyUserTypes("user"))
+	require.NoError(t, err)
+
+	expectedDOT = `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [
+label=or
+shape=diamond
+];
+1 [label="document#viewer"];
+2 [label=user];
+3 [label="group#member"];
+4 [label="user:*"];
+
+// Edge definitions.
+0 -> 1 [label=1];
+2 -> 0 [label=2];
+2 -> 3 [label=5];
+3 -> 0 [label=3];
+3 -> 0 [
+headlabel="(member from document#parent)"
+label=4
+];
+3 -> 3 [
+color=blue
+label=7
+];
+4 -> 3 [label=6];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+}
+
+func TestWriter_Truncation(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user]
+				define viewer: [user] or editor or viewer from parent`
+
+	actualDOT, cycleInfo, err := Writer(model, WithMaxEdges(3))
+	require.NoError(t, err)
+
+	expectedDOT := `// graph truncated: showing 6 of 7 nodes and 3 of 7 edges
+digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=user];
+1 [label="document#editor"];
+2 [label=folder];
+3 [label="document#parent"];
+4 [
+label=or
+shape=diamond
+];
+5 [label="document#viewer"];
+
+// Edge definitions.
+0 -> 1 [label=1];
+2 -> 3 [label=2];
+4 -> 5 [label=3];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+	require.Equal(t, []string{"graph truncated: showing 6 of 7 nodes and 3 of 7 edges"}, cycleInfo.warnings)
+
+	actualDOT, cycleInfo, err = Writer(model, WithMaxNodes(4))
+	require.NoError(t, err)
+
+	expectedDOT = `// graph truncated: showing 4 of 7 nodes and 2 of 7 edges
+digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=user];
+1 [label="document#editor"];
+2 [label=folder];
+3 [label="document#parent"];
+
+// Edge definitions.
+0 -> 1 [label=1];
+2 -> 3 [label=2];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+	require.Equal(t, []string{"graph truncated: showing 4 of 7 nodes and 2 of 7 edges"}, cycleInfo.warnings)
+
+	actualDOT, cycleInfo, err = Writer(model, WithMaxNodes(100), WithMaxEdges(100))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(actualDOT, "digraph {"))
+	require.Empty(t, cycleInfo.warnings)
+}
+
+func TestWriter_InlineAssignable(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, group#member]
+		type document
+			relations
+				define editor: [user, user:*, group#member with cond]
+				define viewer: editor
+
+		condition cond(x: int) {
+			x < 100
+		}`
+
+	actualDOT, _, err := Writer(model, WithInlineAssignable())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#editor\n[user, user:*, group#member with cond]"];
+3 [label=user];
+4 [label="user:*"];
+5 [label="group[with cond]#member"];
+6 [label="document#viewer"];
+9 [label="group#member\n[user, group#member]"];
+
+// Edge definitions.
+2 -> 6 [
+label=4
+style=dashed
+];
+3 -> 2 [label=1];
+3 -> 9 [label=5];
+4 -> 2 [label=2];
+5 -> 2 [label=3];
+9 -> 9 [
+color=blue
+label=6
+];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+}
+
+func TestWriter_GraphAttributes(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`
+
+	actualDOT, _, err := Writer(model, WithGraphAttributes("bgcolor=white", "nodesep=0.5", "rankdir=LR"))
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=LR
+bgcolor=white
+nodesep=0.5
+];
+
+// Node definitions.
+2 [label="document#viewer"];
+3 [label=user];
+
+// Edge definitions.
+3 -> 2 [label=1];
+}`
+	require.Empty(t, cmp.Diff(expectedDOT, actualDOT))
+
+	for _, attr := range []string{"bgcolor", "=white", "bgcolor="} {
+		_, _, err = Writer(model, WithGraphAttributes(attr))
+		require.ErrorContains(t, err, fmt.Sprintf("invalid graph attribute %q: expected key=value", attr))
+	}
+}
+
+func TestWriter_NoEmptyAttributes(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member, user with condition1]
+		type folder
+			relations
+				define viewer: [user, group#member] or viewer from parent
+				define parent: [folder]
+		type document
+			relations
+				define parent: [folder]
+				define blocked: [user]
+				define editor: [user with condition1]
+				define viewer: (editor or viewer from parent) but not blocked
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	emptyAttribute := regexp.MustCompile(`\w+=""`)
+	for _, opts := range [][]Option{
+		nil,
+		{WithOperatorNodes(), WithTooltips()},
+		{WithCollapsedConditions(), WithReverse()},
+		{WithOutputFormat(formatDOTClusterByRewrite), WithLegend()},
+		{WithTuplesetHops(), WithWeights(), WithHTMLLabels()},
+		{WithTypeSummary(), WithSummaryCounts()},
+		{WithRecordNodes(), WithSortedEdges()},
+	} {
+		actualDOT, _, err := Writer(model, opts...)
+		require.NoError(t, err)
+
+		// the points of the legend are deliberately unlabeled
+		withoutLegend := strings.ReplaceAll(actualDOT, `label=""
+shape=point`, "")
+		require.Empty(t, emptyAttribute.FindAllString(withoutLegend, -1), actualDOT)
+	}
+}
+
+func TestWriter_NoRelations(t *testing.T) {
+	testCases := map[string]string{
+		`only_user`: `
+			model
+				schema 1.1
+			type user`,
+		`only_types`: `
+			model
+				schema 1.1
+			type user
+			type document`,
+		`no_types`: `
+			model
+				schema 1.1`,
+	}
+
+	for name, model := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for _, opts := range [][]Option{
+				nil,
+				{WithOutputFormat(formatDOTClusterByRewrite), WithTypeSummary(), WithSummaryCounts()},
+				{WithRecordNodes(), WithSortedEdges(), WithClosureSizes(), WithCyclesOnly(), WithMaxNodes(1)},
+				{WithTuplesetHops(), WithReverse(), WithHTMLLabels(), WithWeights()},
+			} {
+				actualDOT, cycleInfo, err := Writer(model, opts...)
+				require.NoError(t, err)
+				require.Equal(t, "digraph {\ngraph [\nrankdir=BT\n];\n\n}", actualDOT)
+
+				require.Zero(t, cycleInfo.possibleCycles)
+				require.Zero(t, cycleInfo.definitiveCycles)
+				require.Empty(t, cycleInfo.cycles)
+				require.Empty(t, cycleInfo.definitiveCyclePaths)
+				require.Empty(t, cycleInfo.isolatedRelations)
+				require.Empty(t, cycleInfo.warnings)
+				require.Zero(t, cycleInfo.metrics.nodes)
+				require.Zero(t, cycleInfo.metrics.edges)
+				require.Zero(t, cycleInfo.metrics.relations)
+				require.Zero(t, cycleInfo.metrics.maxDepth)
+			}
+
+			actualGraphML, _, err := Writer(model, WithOutputFormat(formatGraphML))
+			require.NoError(t, err)
+			require.NoError(t, xml.Unmarshal([]byte(actualGraphML), &graphML{}))
+
+			reachable, err := RelationsReachableFrom(model, "user")
+			if name == "no_types" {
+				require.EqualError(t, err, "type user not found in the model")
+			} else {
+				require.NoError(t, err)
+				require.Empty(t, reachable)
+			}
+		})
+	}
+}
+
+func TestWriter_WildcardLabel(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*]
+		type document
+			relations
+				define viewer: [user:*, user:* with condition1, group#member]
+				define editor: [user:*]
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	plainDOT, _, err := Writer(model)
+	require.NoError(t, err)
+	actualDOT, _, err := Writer(model, WithWildcardLabel("{type} (public)"))
+	require.NoError(t, err)
+
+	// only the labels change; the edges from the wildcard still share a single
+	// node per wildcard
+	require.Equal(t, 1, strings.Count(actualDOT, `[label="user (public)"]`))
+	require.Equal(t, 1, strings.Count(actualDOT, `[label="user[with condition1] (public)"]`))
+	require.NotContains(t, actualDOT, ":*")
+
+	expectedDOT := strings.NewReplacer(
+		`[label="user:*"]`, `[label="user (public)"]`,
+		`[label="user[with condition1]:*"]`, `[label="user[with condition1] (public)"]`,
+	).Replace(plainDOT)
+	require.Equal(t, expectedDOT, actualDOT)
+}
+
+func TestWriter_ConditionParams(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user with in_range, user:* with in_range, user]
+				define editor: [user with allowed]
+
+		condition in_range(x: int, bounds: map<int>, tags: list<string>) {
+			x < bounds["max"] && size(tags) > 0
+		}
+		condition allowed(ip: ipaddress, cidr: string) {
+			ip.in_cidr(cidr)
+		}`
+
+	plainDOT, _, err := Writer(model)
+	require.NoError(t, err)
+	require.Contains(t, plainDOT, `[label="user[with in_range]"]`)
+
+	// parameters are listed by name, spelled like in the DSL
+	actualDOT, _, err := Writer(model, WithConditionParams())
+	require.NoError(t, err)
+	require.Equal(t, `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#editor"];
+3 [label="user[with allowed(cidr: string, ip: ipaddress)]"];
+4 [label="document#viewer"];
+5 [label="user[with in_range(bounds: map<int>, tags: list<string>, x: int)]"];
+6 [label="user[with in_range(bounds: map<int>, tags: list<string>, x: int)]:*"];
+7 [label=user];
+
+// Edge definitions.
+3 -> 2 [label=1];
+5 -> 4 [label=2];
+6 -> 4 [label=3];
+7 -> 4 [label=4];
+}`, actualDOT)
+}
+
+func TestWriter_TuplesetLabel(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent`
+
+	actualDOT, _, err := Writer(model, WithTuplesetLabel("from {tupleset}"))
+	require.NoError(t, err)
+	require.Equal(t, `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label="document#parent"];
+3 [label=folder];
+4 [label="document#viewer"];
+5 [
+label=or
+shape=diamond
+];
+6 [label=user];
+7 [label="folder#viewer"];
+
+// Edge definitions.
+3 -> 2 [label=1];
+5 -> 4 [label=2];
+6 -> 5 [label=3];
+6 -> 7 [label=5];
+7 -> 5 [
+headlabel="from parent"
+label=4
+];
+}`, actualDOT)
+
+	// the default is the same as its template spelled out, and reversed
+	// edges keep the label next to the relation as their tail label
+	plainDOT, _, err := Writer(model, WithReverse())
+	require.NoError(t, err)
+	actualDOT, _, err = Writer(model, WithReverse(), WithTuplesetLabel("({relation} from {type}#{tupleset})"))
+	require.NoError(t, err)
+	require.Equal(t, plainDOT, actualDOT)
+
+	actualDOT, _, err = Writer(model, WithReverse(), WithTuplesetLabel("{relation} from {type}.{tupleset}"))
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, `taillabel="viewer from document.parent"`)
+}
+
+func TestWriter_Highlight(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define owner: [user]
+				define viewer: [user] or owner`
+
+	actualDOT, _, err := Writer(model, WithHighlight("document#owner"))
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, `color=red
+label="document#owner"
+penwidth=2
+];`)
+	require.Contains(t, actualDOT, `label="document#viewer"`)
+	require.Contains(t, actualDOT, "color=gray")
+
+	_, _, err = Writer(model, WithHighlight("document"))
+	require.EqualError(t, err, `invalid relation "document": expected type#relation`)
+
+	_, _, err = Writer(model, WithHighlight("document#editor"))
+	require.EqualError(t, err, "relation document#editor not found in the model")
+}
+
+func TestWriter_ClosureSizes(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type team
+			relations
+				define member: [user]
+		type document
+			relations
+				define owner: [user]
+				define viewer: [team#member, team] or owner`
+
+	for name, opts := range map[string][]Option{
+		"plain":   nil,
+		"reverse": {WithReverse()},
+		"sorted":  {WithSortedEdges()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actualDOT, _, err := Writer(model, append(opts, WithClosureSizes())...)
+			require.NoError(t, err)
+			require.Contains(t, actualDOT, `[label="document#viewer\n(2 user types)"]`)
+			require.Contains(t, actualDOT, `[label="document#owner\n(1 user type)"]`)
+			require.Contains(t, actualDOT, `[label="team#member\n(1 user type)"]`)
+			require.Contains(t, actualDOT, `[label=user]`)
+		})
+	}
+
+	// the size follows the list of directly related user types
+	actualDOT, _, err := Writer(model, WithClosureSizes(), WithInlineAssignable())
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, `[label="document#viewer\n[team#member, team]\n(2 user types)"]`)
+
+	// the users of the subtracted operand of an exclusion are denied it, so
+	// they don't count
+	model = `
+		model
+			schema 1.1
+		type user
+		type bot
+		type document
+			relations
+				define blocked: [bot]
+				define viewer: [user]
+				define can_view: viewer but not blocked`
+
+	for name, opts := range map[string][]Option{
+		"plain":          nil,
+		"operator nodes": {WithOperatorNodes()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actualDOT, _, err := Writer(model, append(opts, WithClosureSizes())...)
+			require.NoError(t, err)
+			require.Contains(t, actualDOT, `[label="document#can_view\n(1 user type)"]`)
+			require.Contains(t, actualDOT, `[label="document#blocked\n(1 user type)"]`)
+		})
+	}
+}
+
+func TestWriter_DPIAndSize(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define viewer: [user]`
+
+	actualDOT, _, err := Writer(model, WithDPI(300), WithSize("7.5,10!"))
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+dpi=300
+size="7.5,10!"
+];
+
+// Node definitions.
+2 [label="document#viewer"];
+3 [label=user];
+
+// Edge definitions.
+3 -> 2 [label=1];
+}`
+	require.Empty(t, cmp.Diff(expectedDOT, actualDOT))
+
+	// Graph attributes override them.
+	actualDOT, _, err = Writer(model, WithDPI(300), WithGraphAttributes("dpi=72"))
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, "dpi=72\n")
+	require.NotContains(t, actualDOT, "dpi=300")
+
+	_, _, err = Writer(model, WithDPI(-1))
+	require.ErrorContains(t, err, "invalid dpi -1")
+
+	for _, size := range []string{"big", "7.5x10", "7.5,", ",10", "-1"} {
+		_, _, err = Writer(model, WithSize(size))
+		require.ErrorContains(t, err, fmt.Sprintf("invalid size %q", size))
+	}
+}
+
+func TestWriter_TypeSummary(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user]
+				define viewer: editor or viewer from parent`
+
+	actualDOT, _, err := Writer(model, WithTypeSummary())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=user];
+1 [label=document];
+2 [label=folder];
+3 [label=group];
+
+// Edge definitions.
+0 -> 1 [label=1];
+0 -> 2 [label=3];
+0 -> 3 [label=5];
+2 -> 1 [label=2];
+3 -> 2 [label=4];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+}
+
+func TestWriter_TypeSummaryCounts(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, group#member]
+		type folder
+			relations
+				define viewer: [user, group#member]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user]
+				define viewer: editor or viewer from parent`
+
+	actualDOT, _, err := Writer(model, WithTypeSummary(), WithSummaryCounts())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=user];
+1 [label=document];
+2 [label=folder];
+3 [label=group];
+
+// Edge definitions.
+0 -> 1 [label="1 [1]"];
+0 -> 2 [label="3 [1]"];
+0 -> 3 [label="5 [2]"];
+2 -> 1 [label="2 [2]"];
+3 -> 2 [label="4 [1]"];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	// without the type summary there is nothing to count
+	plainDOT, _, err := Writer(model)
+	require.NoError(t, err)
+	countedDOT, _, err := Writer(model, WithSummaryCounts())
+	require.NoError(t, err)
+	require.Empty(t, cmp.Diff(getSorted(plainDOT), getSorted(countedDOT)))
+}
+
+func TestWriter_Legend(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user] or viewer
+				define viewer: [user] or editor`
+
+	plainDOT, plainCycleInfo, err := Writer(model)
+	require.NoError(t, err)
+
+	actualDOT, cycleInfo, err := Writer(model, WithLegend())
+	require.NoError(t, err)
+
+	require.Contains(t, actualDOT, "subgraph cluster_legend {")
+	require.Contains(t, actualDOT, `"direct assignment from" -> "direct assignment";`)
+	require.Contains(t, actualDOT, `"computed userset from" -> "computed userset" [style=dashed];`)
+	require.Contains(t, actualDOT, `"subtracted (but not) from" -> "subtracted (but not)" [arrowhead=tee];`)
+	require.NotContains(t, plainDOT, "cluster_legend")
+
+	// the legend is written the same on every run
+	againDOT, _, err := Writer(model, WithLegend())
+	require.NoError(t, err)
+	require.Equal(t, actualDOT, againDOT)
+
+	// The legend is only drawn, so it doesn't change the cycles or metrics.
+	require.Equal(t, plainCycleInfo.cycles, cycleInfo.cycles)
+	require.Equal(t, plainCycleInfo.possibleCycles, cycleInfo.possibleCycles)
+	require.Equal(t, plainCycleInfo.definitiveCycles, cycleInfo.definitiveCycles)
+	require.Equal(t, plainCycleInfo.metrics, cycleInfo.metrics)
+}
+
+func TestWriter_HTMLLabels(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type document
+			relations
+				define viewer: [user, group#member]`
+
+	actualDOT, _, err := Writer(model, WithHTMLLabels())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+2 [label=<<b>document#</b>viewer>];
+3 [label=user];
+4 [label=<<b>group#</b>member>];
+
+// Edge definitions.
+3 -> 2 [label=1];
+3 -> 4 [label=3];
+4 -> 2 [label=2];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	// The line breaks of labels listing the assignable types become <br/>.
+	actualDOT, _, err = Writer(model, WithHTMLLabels(), WithInlineAssignable())
+	require.NoError(t, err)
+	require.Contains(t, actualDOT, "label=<<b>document#</b>viewer<br/>[user, group#member]>")
+}
+
+func TestNodeLabel(t *testing.T) {
+	assert.Equal(t, "user", nodeLabel("user", "", false, ""))
+	assert.Equal(t, "user:*", nodeLabel("user", "", true, ""))
+	assert.Equal(t, "group#member", nodeLabel("group", "member", false, ""))
+	assert.Equal(t, "user[with condition1]", nodeLabel("user", "", false, "condition1"))
+	assert.Equal(t, "user[with condition1]:*", nodeLabel("user", "", true, "condition1"))
+	assert.Equal(t, "group[with condition1]#member", nodeLabel("group", "member", false, "condition1"))
+	assert.Equal(t, "group[with condition1]#member", nodeLabel(" group ", " member", false, "condition1 "))
+}
+
+func TestWriter_LabelsAreTrimmed(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user, user:*, user with condition1, user:* with condition1, group#member, group#member with condition1]
+		type folder
+			relations
+				define viewer: [user, group#member] or viewer from parent
+				define parent: [folder, folder with condition1]
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user with condition1]
+				define viewer: (editor or viewer from parent) but not member from parent
+				define member: [group#member]
+
+		condition condition1(x: int) {
+			x < 100
+		}`
+
+	parsed, err := parseModel(model)
+	require.NoError(t, err)
+
+	for _, opts := range [][]Option{nil, {WithCollapsedConditions()}, {WithInlineAssignable()}} {
+		g, _ := buildGraph(parsed, newOptions(opts...))
+		withoutWhitespace := map[string]string{}
+		for _, label := range g.NodeLabels() {
+			require.Equal(t, strings.TrimSpace(label), label)
+
+			key := strings.Join(strings.Fields(label), "")
+			if other, ok := withoutWhitespace[key]; ok {
+				t.Fatalf("labels %q and %q differ only in whitespace", other, label)
+			}
+			withoutWhitespace[key] = label
+		}
+	}
+}
+
+func TestWriter_ForwardReferences(t *testing.T) {
+	// types and relations are processed in sorted order, so document is drawn
+	// before folder and zebra, and document#a before document#b and
+	// document#c: every edge below refers to a node whose own definition is
+	// drawn later
+	model := `
+		model
+			schema 1.1
+		type zebra
+			relations
+				define member: [user]
+		type user
+		type folder
+			relations
+				define viewer: [user, zebra#member]
+		type document
+			relations
+				define parent: [folder]
+				define a: b or viewer from parent
+				define b: c
+				define c: [user]
+				define viewer: viewer from parent`
+
+	parsed, err := parseModel(model)
+	require.NoError(t, err)
+
+	for _, opts := range [][]Option{nil, {WithOperatorNodes()}} {
+		g, _ := buildGraph(parsed, newOptions(opts...))
+
+		// every label is mapped to exactly one node and back
+		require.Len(t, g.reverseMapping, len(g.mapping))
+		require.Equal(t, g.Nodes().Len(), len(g.mapping))
+		for label, id := range g.mapping {
+			require.Equal(t, label, g.reverseMapping[id])
+			if n := g.Node(id).(*dotNode); n.operatorOf == "" {
+				require.Equal(t, label, n.attrs["label"], "node %s is labeled differently", label)
+			}
+		}
+
+		// the node referenced before its definition was drawn is the node its
+		// definition is drawn into
+		var edges []string
+		for _, l := range g.SortedLines() {
+			edges = append(edges, fmt.Sprintf("%s -> %s", g.reverseMapping[l.From().ID()], g.relationOf(l.To())))
+		}
+		for _, edge := range []string{
+			"folder#viewer -> document#viewer",
+			"folder#viewer -> document#a",
+			"user -> folder#viewer",
+			"zebra#member -> folder#viewer",
+			"user -> zebra#member",
+			"document#b -> document#a",
+			"document#c -> document#b",
+			"user -> document#c",
+		} {
+			require.Contains(t, edges, edge)
+		}
+	}
+}
+
+func TestWriter_SortedEdges(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define archive: [folder]
+				define viewer: viewer from parent or viewer from archive`
+
+	// compared as is, without sorting the lines first: the output itself is
+	// sorted, and every run writes the attributes in the same order
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label="document#archive"];
+1 [label="document#parent"];
+2 [label="document#viewer"];
+3 [
+label=or
+shape=diamond
+];
+4 [label=folder];
+5 [label="folder#viewer"];
+6 [label=user];
+
+// Edge definitions.
+3 -> 2 [label=3];
+4 -> 0 [label=1];
+4 -> 1 [label=2];
+5 -> 3 [
+headlabel="(viewer from document#parent)"
+label=4
+];
+5 -> 3 [
+headlabel="(viewer from document#archive)"
+label=5
+];
+6 -> 5 [label=6];
+}`
+	for i := 0; i < 10; i++ {
+		actualDOT, _, err := Writer(model, WithSortedEdges())
+		require.NoError(t, err)
+		require.Equal(t, expectedDOT, actualDOT)
+	}
+}
+
+func TestWriter_CollidingRelationNames(t *testing.T) {
+	// every type defines editor, viewer and parent, so that an edge drawn
+	// from the relation of the wrong type would go unnoticed by its name
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define parent: [folder]
+				define editor: [user]
+				define viewer: editor or viewer from parent
+		type document
+			relations
+				define parent: [folder]
+				define editor: [user]
+				define viewer: editor or viewer from parent`
+
+	parsed, err := parseModel(model)
+	require.NoError(t, err)
+
+	g, _ := buildGraph(parsed, newOptions())
+	g = g.RelationGraph()
+
+	edges := map[string][]string{}
+	for _, l := range g.SortedLines() {
+		to := g.reverseMapping[l.To().ID()]
+		edges[to] = append(edges[to], g.reverseMapping[l.From().ID()])
+	}
+
+	// computed usersets stay within their type, tuple to usersets go to the
+	// type of the tupleset
+	require.ElementsMatch(t, []string{"document#editor", "folder#viewer"}, edges["document#viewer"])
+	require.ElementsMatch(t, []string{"folder#editor", "folder#viewer"}, edges["folder#viewer"])
+	require.ElementsMatch(t, []string{"user"}, edges["document#editor"])
+	require.ElementsMatch(t, []string{"user"}, edges["folder#editor"])
+
+	// a computed userset can't refer to the relation of another type, even if
+	// another type defines a relation of that name
+	actualDOT, cycleInfo, err := Writer(`
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define owner: [user]
+		type document
+			relations
+				define viewer: owner`)
+	require.NoError(t, err)
+	require.NotContains(t, actualDOT, `"folder#owner" -> "document#viewer"`)
+	assert.Contains(t, cycleInfo.warnings, "relation document#viewer references undefined relation document#owner")
+
+	// only the types of the tupleset that define the relation are drawn from
+	parsed, err = parseModel(`
+		model
+			schema 1.1
+		type user
+		type group
+			relations
+				define member: [user]
+		type folder
+			relations
+				define writer: [user]
+		type document
+			relations
+				define parent: [folder, group]
+				define writer: writer from parent`)
+	require.NoError(t, err)
+
+	g, _ = buildGraph(parsed, newOptions())
+	require.NotContains(t, g.mapping, "group#writer")
+	require.Contains(t, g.mapping, "folder#writer")
+}
+
+func TestWriter_TuplesetHops(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent
+		type document
+			relations
+				define parent: [folder]
+				define viewer: viewer from parent`
+
+	actualDOT, cycleInfo, err := Writer(model, WithTuplesetHops())
+	require.NoError(t, err)
+
+	expectedDOT := `digraph {
+graph [
+rankdir=BT
+];
+
+// Node definitions.
+0 [label=folder];
+1 [label="document#parent"];
+2 [label="folder#viewer"];
+3 [label="document#viewer"];
+4 [label="folder#parent"];
+5 [
+label=or
+shape=diamond
+];
+6 [label=user];
+
+// Edge definitions.
+0 -> 1 [label=1];
+0 -> 4 [label=4];
+1 -> 3 [
+headlabel="(viewer from document#parent)"
+label=3
+];
+2 -> 1 [label=2];
+2 -> 4 [
+color=blue
+label=7
+];
+4 -> 5 [
+color=blue
+headlabel="(viewer from folder#parent)"
+label=8
+];
+5 -> 2 [label=5];
+6 -> 5 [label=6];
+}`
+	require.Empty(t, cmp.Diff(getSorted(expectedDOT), getSorted(actualDOT)), actualDOT)
+
+	// The hops are only drawn, so they don't change the cycles.
+	_, plainCycleInfo, err := Writer(model)
+	require.NoError(t, err)
+	require.Equal(t, plainCycleInfo.cycles, cycleInfo.cycles)
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWriteTo(t *testing.T) {
+	model := `
+		model
+			schema 1.1
+		type user
+		type document
+			relations
+				define editor: [user]
+				define viewer: [user] or editor`
+
+	expectedDOT, expectedCycleInfo, err := Writer(model, WithHeader(false), WithMaxEdges(2))
+	require.NoError(t, err)
+
+	var actualDOT strings.Builder
+	cycleInfo, err := WriteTo(&actualDOT, model, WithHeader(false), WithMaxEdges(2))
+	require.NoError(t, err)
+	require.Equal(t, expectedDOT, actualDOT.String())
+	require.Equal(t, expectedCycleInfo, cycleInfo)
+	require.True(t, strings.HasPrefix(actualDOT.String(), "// generated by openfga-graphviz-gen\n"))
+	require.Contains(t, actualDOT.String(), "// graph truncated")
+
+	// nothing is written for models that can't be rendered
+	var empty strings.Builder
+	_, err = WriteTo(&empty, model, WithGraphAttributes("bgcolor"))
+	require.Error(t, err)
+	require.Empty(t, empty.String())
+
+	_, err = WriteTo(failingWriter{}, model)
+	require.EqualError(t, err, "failed to write graph: disk full")
+}
+
+func TestWriterFromModel_Concurrent(t *testing.T) {
+	modelString := `
+		model
+			schema 1.1
+		type user
+		type folder
+			relations
+				define viewer: [user]
+		type document
+			relations
+				define parent: [folder]
+				define viewer: [user] or viewer from parent`
+
+	model, err := parseModel(modelString)
+	require.NoError(t, err)
+
+	expected, _, err := Writer(modelString)
+	require.NoError(t, err)
+
+	// the results are checked once every goroutine is done, since require
+	// may only stop the test from the test goroutine
+	actuals := make([]string, 16)
+	errs := make([]error, len(actuals))
+	var wg sync.WaitGroup
+	for i := range actuals {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			actuals[i], _, errs[i] = WriterFromModel(model)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, actual := range actuals {
+		require.NoError(t, errs[i])
+		require.Equal(t, getSorted(expected), getSorted(actual))
+	}
+
+	// The type definitions of the model are left in the order they were
+	// defined in.
+	var types []string
+	for _, typedef := range model.GetTypeDefinitions() {
+		types = append(types, typedef.GetType())
+	}
+	require.Equal(t, []string{"user", "folder", "document"}, types)
+}
+
 // getSorted assumes the input has multiple lines and returns the sorted version of it.
 func getSorted(input string) string {
 	lines := strings.FieldsFunc(input, func(r rune) bool {